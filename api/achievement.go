@@ -0,0 +1,35 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Counts the events and unlocks the achievements the user has completed. The
+// action that caused the events has already succeeded, so errors are only logged
+// and the achievements are unlocked by the next event.
+func trackAchievements(db *dynamodb.DynamoDB, user *structs.User, events ...string) {
+	unlocked, err := user.TrackAchievements(db, time.Now().UTC(), events...)
+	if err != nil {
+		log.Printf("Cannot track achievements of user %s: %s", user.ID, err)
+	}
+	for _, a := range unlocked {
+		log.Printf("User %s unlocked achievement %s", user.ID, a.ID)
+	}
+}
+
+// Returns the user's progress on every achievement.
+func GetAchievements(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.Achievements())
+}
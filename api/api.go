@@ -4,9 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"oguzhanakan0/good-blast-api/auth"
 	"oguzhanakan0/good-blast-api/config"
 	"oguzhanakan0/good-blast-api/structs"
-	"sort"
 	"strconv"
 	"time"
 
@@ -17,39 +17,127 @@ import (
 	"github.com/google/uuid"
 )
 
-// Creates a user in database.
-func CreateUser(c *gin.Context) {
-	// Instantiate a user
-	user := structs.User{
-		ID:    (uuid.New()).String(),
-		Level: config.UserStartLevel,
-		Coins: config.UserStartCoin,
+// Returns a new user with the starting level, coins and lives.
+func newUser() structs.User {
+	return structs.User{
+		ID:              (uuid.New()).String(),
+		Level:           config.UserStartLevel,
+		Coins:           config.UserStartCoin,
+		Inventory:       map[string]int{},
+		Lives:           config.UserMaxLives,
+		LivesRefilledAt: time.Now().UTC().Format(time.RFC3339),
+		Role:            structs.RolePlayer,
+	}
+}
+
+// Fields a client can set when creating a user. Everything else starts from
+// the defaults of newUser.
+type CreateUserRequest struct {
+	DeviceID string `json:"deviceID" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Country  string `json:"country"`
+}
+
+// Returns the status code of an error from creating or updating a user.
+func usernameStatus(err error) int {
+	switch err {
+	case structs.ErrUsernameTaken, structs.ErrIdentityTaken, structs.ErrUserChanged:
+		return http.StatusConflict
+	case structs.ErrRenameCooldown, structs.ErrTimezoneCooldown:
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Returns the country of a new user: the given one if set, otherwise the one
+// from the geo header or the Accept-Language header of the request. Returns ""
+// if none is known.
+func countryOf(c *gin.Context, given string) (string, error) {
+	if given != "" {
+		return structs.NormalizeCountry(given)
 	}
+	if country, err := structs.NormalizeCountry(c.GetHeader(config.CountryHeader)); err == nil {
+		return country, nil
+	}
+	return structs.CountryFromAcceptLanguage(c.GetHeader("Accept-Language")), nil
+}
 
+// Creates a user in database with the device as its identity and logs it in, like
+// the first login from a device with a chosen username. Responds with the user and
+// its tokens.
+func CreateUser(c *gin.Context) {
 	// Parse JSON from request body
-	if err := c.BindJSON(&user); err != nil {
+	var body CreateUserRequest
+	if err := c.BindJSON(&body); err != nil {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
 	// Validator(s)
-	if len(user.Username) < config.UsernameMinLength {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Username must contain at least 3 characters."})
+	username, err := structs.NormalizeUsername(body.Username)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+
+	country, err := countryOf(c, body.Country)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
 		return
 	}
 
 	// Create user in database
+	user := newUser()
+	user.Username = username
+	user.Country = country
+	identity := structs.NewIdentity(structs.IdentityKindDevice, body.DeviceID, user.ID)
+	user.Identities = []string{identity.ID}
 	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
-	out, err := user.Put(db)
+	signer, _ := c.MustGet("signer").(*auth.Signer)
+	err = user.Create(db, identity)
+	if err != nil {
+		c.IndentedJSON(usernameStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	tokens, err := signer.Login(db, user, time.Now().UTC())
 	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	_ = out
-	c.IndentedJSON(http.StatusCreated, user)
+	c.IndentedJSON(http.StatusCreated, struct {
+		structs.User
+		auth.Tokens
+	}{user, tokens})
+}
+
+// Updates the given profile fields of a user. See User.UpdateProfile for the
+// rules of changing usernames and countries.
+func UpdateUser(c *gin.Context) {
+	var body structs.ProfileUpdate
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := body.Normalize(); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err := user.UpdateProfile(db, body, time.Now().UTC()); err != nil {
+		c.IndentedJSON(usernameStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user)
 }
 
-// Updates user information when they level up.
+// Reports a completed level. The result must belong to the attempt started with
+// POST /user/:id/level/start; coins and tournament score are calculated from it.
 func UpdateProgress(c *gin.Context) {
 	// Fetch user
 	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
@@ -60,16 +148,140 @@ func UpdateProgress(c *gin.Context) {
 		return
 	}
 
-	// Update progress (eg level up)
-	tournamentID := time.Now().UTC().Format("2006-01-02")
-	out, err := user.LevelUp(db, tournamentID)
+	var result structs.LevelResult
+	if err := c.BindJSON(&result); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	completeLevel(c, db, user, result)
+}
+
+// Validates the result and levels the user up, then responds with the user.
+func completeLevel(c *gin.Context, db *dynamodb.DynamoDB, user structs.User, result structs.LevelResult) {
+	err := user.CompleteLevel(db, result, time.Now().UTC())
+	switch {
+	case err == nil:
+		trackAchievements(db, &user)
+		c.IndentedJSON(http.StatusOK, user)
+	case err == structs.ErrAttemptFinished, err == structs.ErrLevelMismatch:
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+	case err == structs.ErrTooFast, errors.Is(err, structs.ErrInvalidResult):
+		c.IndentedJSON(http.StatusUnprocessableEntity, gin.H{"message": err.Error()})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
+
+// Returns a user's lives and when the next one regenerates.
+func GetLives(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.LivesStatus(time.Now().UTC()))
+}
+
+// Buys lives with coins.
+func BuyLives(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	body := struct {
+		Quantity int `json:"quantity"`
+	}{Quantity: 1}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	now := time.Now().UTC()
+	err = user.BuyLives(db, body.Quantity, now)
+	if err == structs.ErrLivesChanged {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.LivesStatus(now))
+}
+
+// Starts a level attempt, spending a life.
+func StartLevel(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	attempt, err := user.StartAttempt(db, time.Now().UTC())
+	if err == structs.ErrNoLives {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	}
+	if err == structs.ErrLivesChanged {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
 	if err != nil {
 		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
 		return
 	}
-	_ = out
+	c.IndentedJSON(http.StatusCreated, attempt)
+}
 
-	c.Status(http.StatusOK)
+// Reports the result of a level attempt. A completed level is validated and levels
+// the user up like POST /user/:id/progress, a failed level loses the spent life.
+func FinishLevel(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	var body struct {
+		structs.LevelResult
+		Success bool `json:"success"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if body.Success {
+		completeLevel(c, db, user, body.LevelResult)
+		return
+	}
+
+	now := time.Now().UTC()
+	err = user.FailAttempt(db, body.AttemptID, now)
+	if err == structs.ErrNoAttempt {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err == structs.ErrLivesChanged {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.LivesStatus(now))
 }
 
 // Returns a given user.
@@ -84,6 +296,50 @@ func GetUser(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, user)
 }
 
+// Returns the items a user owns.
+func GetInventory(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.Inventory)
+}
+
+// Uses up the given quantity of an item (1 by default) from a user's inventory.
+func ConsumeItem(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	body := struct {
+		Quantity int `json:"quantity"`
+	}{Quantity: 1}
+	if c.Request.ContentLength > 0 {
+		if err := c.BindJSON(&body); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+	}
+	if _, ok := structs.Items[c.Param("item")]; !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Item does not exist."})
+		return
+	}
+
+	err = user.ConsumeItem(db, c.Param("item"), body.Quantity)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.Inventory)
+}
+
 // Returns all the users in database.
 func GetUsers(c *gin.Context) {
 	// Scan database for all users
@@ -104,6 +360,11 @@ func GetUsers(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, users)
 }
 
+// Lists the country codes users can choose from.
+func GetCountries(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, structs.Countries())
+}
+
 // Returns a given tournament.
 func GetTournament(c *gin.Context) {
 	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
@@ -116,6 +377,27 @@ func GetTournament(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, tournament)
 }
 
+// Cancels a tournament and refunds the entry fees of its participants.
+func CancelTournament(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	tournament := structs.Tournament{ID: c.Param("id")}
+	err := tournament.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if tournament.Completed {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "This tournament has already been completed."})
+		return
+	}
+	err = tournament.Cancel(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, tournament)
+}
+
 // Returns all tournaments.
 func GetTournaments(c *gin.Context) {
 	// Scan database for all tournaments
@@ -159,17 +441,25 @@ func EnterTournament(c *gin.Context) {
 		return
 	}
 
+	// Entry cost is paid with coins unless a ticket is requested
+	payment := c.DefaultQuery("payWith", structs.PaymentCoins)
+
 	// Check if user can enter the tournament
-	if yes, err := user.CanEnterTournament(t); !yes {
+	if yes, err := user.CanEnterTournament(t, payment); !yes {
 		c.IndentedJSON(http.StatusForbidden, gin.H{"message": err.Error()})
 		return
 	}
 
 	// Add user to the tournament
-	err = user.EnterTournament(db, t)
-	if err != nil {
-		panic(err)
+	err = user.EnterTournament(db, t, payment)
+	if err == structs.ErrEntryRejected || err == structs.ErrTournamentClosed {
+		c.IndentedJSON(http.StatusForbidden, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
 	}
+	trackAchievements(db, &user, structs.MetricTournamentsEntered)
 	c.Status(http.StatusOK)
 }
 
@@ -220,7 +510,11 @@ func GetLeaderboard(c *gin.Context) {
 		return
 	}
 
-	board, ok := tournament.Leaderboards[c.Param("countryCode")]
+	country := c.Param("countryCode")
+	if normalized, err := structs.NormalizeCountry(country); err == nil {
+		country = normalized
+	}
+	board, ok := tournament.Leaderboards[country]
 	if !ok {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": fmt.Sprintf("Country %s is not found in the leaderboards.", c.Param("countryCode"))})
 		return
@@ -248,6 +542,36 @@ func GetUserLeaderboard(c *gin.Context) {
 	c.IndentedJSON(http.StatusOK, board)
 }
 
+// Returns the rewards that are fixed for the user at tournament finalization.
+func GetRewards(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, user.Rewards())
+}
+
+// Returns the rewards the user can still claim, with their expiry times.
+func GetUnclaimedRewards(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	err := user.Fetch(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	rewards, err := user.UnclaimedRewards(db, time.Now().UTC())
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, rewards)
+}
+
+// Gives the user their reward for the given tournament.
 func ClaimReward(c *gin.Context) {
 	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
 	// Get the user
@@ -262,41 +586,51 @@ func ClaimReward(c *gin.Context) {
 		c.IndentedJSON(http.StatusAlreadyReported, gin.H{"message": "Reward is already claimed before."})
 		return
 	}
-	// Get leaderboard for user's group
-	board, err := getUserLeaderboard(db, user, c.Param("tournamentID"))
+	// Get the tournament
+	tournament := structs.Tournament{ID: c.Param("tournamentID")}
+	err = tournament.Fetch(db)
 	if err != nil {
 		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
 		return
 	}
-	// Decide the amount
-	var amount int
-	for i, ur := range board {
-		if i > 10 {
-			break
-		}
-		if ur.UserID == user.ID {
-			switch i {
-			case 0:
-				amount = config.TournamentReward1
-			case 1:
-				amount = config.TournamentReward2
-			case 2:
-				amount = config.TournamentReward3
-			default:
-				amount = config.TournamentRewardDefault
-			}
-		}
+	if !tournament.Completed {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Tournament has not been completed yet."})
+		return
+	}
+	// Check if the claim window is over
+	expiresAt, err := tournament.ClaimExpiresAt()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	if time.Now().UTC().After(expiresAt) {
+		c.IndentedJSON(http.StatusGone, gin.H{"message": structs.ErrRewardExpired.Error(), "code": "REWARD_EXPIRED"})
+		return
+	}
+	// Decide the reward
+	reward, err := user.TournamentReward(db, tournament)
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
 	}
-	// Claim reward if amount is greater than zero
-	if amount > 0 {
-		err := user.ClaimReward(db, amount, c.Param("tournamentID"))
+	// Claim reward if anything is earned
+	if !reward.IsEmpty() {
+		err := user.ClaimReward(db, reward, c.Param("tournamentID"))
+		if err == structs.ErrRewardClaimed {
+			c.IndentedJSON(http.StatusAlreadyReported, gin.H{"message": err.Error()})
+			return
+		}
 		if err != nil {
 			panic(err)
 		}
-		c.IndentedJSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Claimed %d coins!", amount)})
+		events := []string{structs.MetricRewardsClaimed}
+		if rank, err := user.GroupRank(db, tournament); err == nil && rank == 1 {
+			events = append(events, structs.MetricFirstPlaces)
+		}
+		trackAchievements(db, &user, events...)
+		c.IndentedJSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Claimed %d coins!", reward.Coins), "items": reward.Items})
 		return
 	}
-	_ = board
 	c.IndentedJSON(http.StatusNotModified, gin.H{"message": "No reward earned in this tournament :("})
 }
 
@@ -320,7 +654,23 @@ func getUserLeaderboard(db *dynamodb.DynamoDB, user structs.User, tournamentID s
 	if err != nil {
 		return players, err
 	}
-	players = group.Players
-	sort.Slice(players, func(i, j int) bool { return players[i].Score > players[j].Score })
-	return players, nil
+	return group.Ranking(), nil
+}
+
+// Returns a page of the tournaments the user has played, latest first. The page
+// size is set with ?limit and the next page is requested with ?before=<next>.
+func GetTournamentHistory(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(config.HistoryPageSize)))
+	if err != nil || limit < 1 {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Limit must be a positive number."})
+		return
+	}
+	tournaments, next := user.TournamentHistory(c.Query("before"), min(limit, config.HistoryMaxPageSize))
+	c.IndentedJSON(http.StatusOK, gin.H{"tournaments": tournaments, "next": next})
 }
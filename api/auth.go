@@ -0,0 +1,173 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"oguzhanakan0/good-blast-api/auth"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Logs in with a device ID. A guest user is created on the first login from a
+// device, later logins return tokens for the same user.
+func DeviceLogin(c *gin.Context) {
+	var body struct {
+		DeviceID string `json:"deviceID" binding:"required"`
+		Username string `json:"username"`
+		Country  string `json:"country"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	signer, _ := c.MustGet("signer").(*auth.Signer)
+
+	identity := structs.NewIdentity(structs.IdentityKindDevice, body.DeviceID, "")
+	status := http.StatusOK
+	if err := identity.Fetch(db); err != nil {
+		// First login from this device, create a guest user
+		user := newUser()
+		user.Username = body.Username
+		user.Country, err = countryOf(c, body.Country)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		if user.Username == "" {
+			user.Username = "Guest#" + (uuid.New()).String()[:8]
+		}
+		user.Username, err = structs.NormalizeUsername(user.Username)
+		if err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+			return
+		}
+		identity.UserID = user.ID
+		user.Identities = []string{identity.ID}
+		err = user.Create(db, identity)
+		if err == structs.ErrIdentityTaken {
+			// Another request registered the device first
+			err = identity.Fetch(db)
+		} else if err == nil {
+			status = http.StatusCreated
+		}
+		if err != nil {
+			c.IndentedJSON(usernameStatus(err), gin.H{"message": err.Error()})
+			return
+		}
+	}
+
+	// The role of the user is carried in the tokens
+	user := structs.User{ID: identity.UserID}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	tokens, err := signer.Login(db, user, time.Now().UTC())
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(status, tokens)
+}
+
+// Sends a login code to a verified identity, e.g. to recover an account on a new
+// device. Responds the same whether or not the identity exists, so that it
+// cannot be used to look up identities.
+func SendLoginCode(c *gin.Context) {
+	var body identityRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	identity, err := structs.ParseIdentity(body.Kind, body.Value)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	if err := identity.Fetch(db); err == nil && identity.Verified {
+		if err := sendCode(c, db, identity); err != nil {
+			log.Printf("Cannot send a login code to %s: %s", identity.ID, err)
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Logs in with a verified identity and the code sent to it, and returns tokens
+// of the user the identity is linked to.
+func IdentityLogin(c *gin.Context) {
+	var body identityCodeRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	signer, _ := c.MustGet("signer").(*auth.Signer)
+	identity, ok := provenIdentity(c, db, body)
+	if !ok {
+		return
+	}
+	user := structs.User{ID: identity.UserID}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	tokens, err := signer.Login(db, user, time.Now().UTC())
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, tokens)
+}
+
+// Exchanges a refresh token for new tokens of the same session.
+func RefreshToken(c *gin.Context) {
+	var body struct {
+		RefreshToken string `json:"refreshToken" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	signer, _ := c.MustGet("signer").(*auth.Signer)
+
+	now := time.Now().UTC()
+	_, session, err := signer.Authenticate(db, body.RefreshToken, auth.TokenTypeRefresh, now)
+	if err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	// The role might have changed since login, so it is read from the user
+	user := structs.User{ID: session.UserID}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	session.Role = user.Role
+	if session.Role == "" {
+		session.Role = structs.RolePlayer
+	}
+	tokens, err := signer.Issue(session, now)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, tokens)
+}
+
+// Revokes the session of the access token. Its refresh token stops working too.
+func Logout(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	session := structs.Session{ID: c.GetString("sessionID"), UserID: c.GetString("userID")}
+	if err := session.Revoke(db); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Gives the user the daily login bonus. Claiming again on the same day in the
+// user's time zone returns the claim of the day without granting anything.
+func ClaimDailyBonus(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	claim, err := user.ClaimDailyBonus(db, time.Now().UTC())
+	if err == structs.ErrUserChanged {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, claim)
+}
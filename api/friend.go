@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Returns the status code of an error from changing friends.
+func friendStatus(err error) int {
+	switch err {
+	case structs.ErrFriendExists:
+		return http.StatusConflict
+	case structs.ErrFriendNotFound, structs.ErrFriendCodeUnknown:
+		return http.StatusNotFound
+	case structs.ErrTooManyFriends:
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Returns the friend code other users can add the user with.
+func GetFriendCode(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	code, err := user.GetFriendCode(db)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{"friendCode": code})
+}
+
+// Lists the user's friends and pending friend requests.
+func GetFriends(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	friends, err := structs.FetchFriends(db, c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, friends)
+}
+
+// Sends a friend request to the user with the given friend code.
+func AddFriend(c *gin.Context) {
+	var body struct {
+		FriendCode string `json:"friendCode" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	friendID, err := structs.FindFriendCode(db, body.FriendCode)
+	if err != nil {
+		c.IndentedJSON(friendStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	friendship, err := structs.SendFriendRequest(db, c.Param("id"), friendID)
+	if err != nil {
+		c.IndentedJSON(friendStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, friendship)
+}
+
+// Accepts a friend request the user received.
+func AcceptFriend(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	friendship, err := structs.AcceptFriendRequest(db, c.Param("id"), c.Param("friendID"))
+	if err != nil {
+		c.IndentedJSON(friendStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, friendship)
+}
+
+// Removes a friend, or declines or cancels a friend request.
+func RemoveFriend(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	err := structs.RemoveFriend(db, c.Param("id"), c.Param("friendID"))
+	if err != nil {
+		c.IndentedJSON(friendStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Ranks the tournament scores of the user and their friends.
+func GetFriendsLeaderboard(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	board, err := structs.FriendsLeaderboard(db, user, c.Param("tournamentID"))
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, board)
+}
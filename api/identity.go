@@ -0,0 +1,266 @@
+package api
+
+import (
+	"net/http"
+	"oguzhanakan0/good-blast-api/auth"
+	"oguzhanakan0/good-blast-api/structs"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+type identityRequest struct {
+	Kind  string `json:"kind" binding:"required"`
+	Value string `json:"value" binding:"required"`
+}
+
+// Returns the identities linked to the user. Identities that cannot be fetched
+// are described by their ID only.
+func identitiesOf(db *dynamodb.DynamoDB, user structs.User) []structs.Identity {
+	identities := []structs.Identity{}
+	for _, id := range user.Identities {
+		identity := structs.Identity{ID: id}
+		if err := identity.Fetch(db); err != nil {
+			kind, value, _ := strings.Cut(id, "#")
+			identity = structs.Identity{ID: id, Kind: kind, Value: value, UserID: user.ID}
+		}
+		identities = append(identities, identity)
+	}
+	return identities
+}
+
+// Lists the identities linked to the user.
+func GetIdentities(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, identitiesOf(db, user))
+}
+
+// Links an identity such as an email or a platform account to the user.
+func LinkIdentity(c *gin.Context) {
+	var body identityRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	identity, err := structs.ParseIdentity(body.Kind, body.Value)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	err = user.LinkIdentity(db, identity)
+	if err == structs.ErrIdentityTaken {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, identitiesOf(db, user))
+}
+
+// Unlinks an identity from the user.
+func UnlinkIdentity(c *gin.Context) {
+	identity, err := structs.ParseIdentity(c.Param("kind"), c.Param("value"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	err = user.UnlinkIdentity(db, identity)
+	switch err {
+	case nil:
+		c.IndentedJSON(http.StatusOK, identitiesOf(db, user))
+	case structs.ErrIdentityNotLinked:
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+	case structs.ErrLastIdentity, structs.ErrUserChanged:
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+	default:
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+	}
+}
+
+// Returns the ID of the user an identity is linked to.
+func GetIdentityUser(c *gin.Context) {
+	identity, err := structs.ParseIdentity(c.Param("kind"), c.Param("value"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	if err := identity.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, identity)
+}
+
+// Returns the identity of the :kind and :value params if it is linked to the
+// user of :id. Otherwise responds with an error and returns false.
+func linkedIdentity(c *gin.Context, db *dynamodb.DynamoDB) (structs.Identity, bool) {
+	identity, err := structs.ParseIdentity(c.Param("kind"), c.Param("value"))
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return identity, false
+	}
+	if err := identity.Fetch(db); err != nil || identity.UserID != c.Param("id") {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": structs.ErrIdentityNotLinked.Error()})
+		return identity, false
+	}
+	return identity, true
+}
+
+// Creates a code for the identity and sends it to its owner.
+func sendCode(c *gin.Context, db *dynamodb.DynamoDB, identity structs.Identity) error {
+	sender, _ := c.MustGet("sender").(auth.CodeSender)
+	code, err := identity.NewCode(db, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return sender.Send(identity, code)
+}
+
+// Returns the status code of an error from sending or using a code.
+func codeStatus(err error) int {
+	switch err {
+	case structs.ErrInvalidCode, structs.ErrIdentityNotVerified:
+		return http.StatusUnauthorized
+	case structs.ErrCodeCooldown:
+		return http.StatusTooManyRequests
+	case auth.ErrCannotSendCode:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Sends a code to a linked identity, e.g. by email, to verify it.
+func SendIdentityCode(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	identity, ok := linkedIdentity(c, db)
+	if !ok {
+		return
+	}
+	if err := sendCode(c, db, identity); err != nil {
+		c.IndentedJSON(codeStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// Verifies a linked identity with the code sent to it.
+func VerifyIdentity(c *gin.Context) {
+	var body struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	identity, ok := linkedIdentity(c, db)
+	if !ok {
+		return
+	}
+	if err := identity.UseCode(db, body.Code, time.Now().UTC()); err != nil {
+		c.IndentedJSON(codeStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	if err := identity.Verify(db, identity.UserID); err != nil {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, identity)
+}
+
+// Returns the verified identity of the request body if the code sent to it is
+// valid. Otherwise responds with an error and returns false.
+func provenIdentity(c *gin.Context, db *dynamodb.DynamoDB, body identityCodeRequest) (structs.Identity, bool) {
+	identity, err := structs.ParseIdentity(body.Kind, body.Value)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return identity, false
+	}
+	if err := identity.Fetch(db); err != nil || !identity.Verified {
+		c.IndentedJSON(http.StatusUnauthorized, gin.H{"message": structs.ErrInvalidCode.Error()})
+		return identity, false
+	}
+	if err := identity.UseCode(db, body.Code, time.Now().UTC()); err != nil {
+		c.IndentedJSON(codeStatus(err), gin.H{"message": err.Error()})
+		return identity, false
+	}
+	return identity, true
+}
+
+type identityCodeRequest struct {
+	Kind  string `json:"kind" binding:"required"`
+	Value string `json:"value" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// Merges the caller, a guest account e.g. created on a new device, into the user
+// who owns a verified identity. The caller proves to own that user with the code
+// sent to the identity (see SendLoginCode). Every session of the guest is
+// revoked, as the account is left empty, and tokens of the user are returned.
+func MergeUser(c *gin.Context) {
+	var body identityCodeRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	signer, _ := c.MustGet("signer").(*auth.Signer)
+	guest := structs.User{ID: c.Param("id")}
+	if err := guest.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	identity, ok := provenIdentity(c, db, body)
+	if !ok {
+		return
+	}
+	user := structs.User{ID: identity.UserID}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+
+	err := user.Merge(db, &guest)
+	if err == structs.ErrUserChanged {
+		c.IndentedJSON(http.StatusConflict, gin.H{"message": err.Error()})
+		return
+	} else if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	if err := structs.RevokeSessions(db, guest.ID); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	tokens, err := signer.Login(db, user, time.Now().UTC())
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, struct {
+		structs.User
+		auth.Tokens
+	}{user, tokens})
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Returns everything stored about the user as a JSON archive.
+func ExportUser(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	export, err := structs.ExportUser(db, c.Param("id"))
+	if err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.Header("Content-Disposition", `attachment; filename="user-`+export.User.ID+`.json"`)
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// Deletes the user in the background. The user is anonymized in groups and
+// leaderboards and the rest of their data is deleted. Pending deletions are
+// resumed by the scheduler if they fail.
+func DeleteUser(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	deletion, err := structs.RequestDeletion(db, user)
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	// The sessions of the user cannot be used anymore
+	if err := structs.RevokeSessions(db, user.ID); err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+	go func() {
+		if err := deletion.Run(db, structs.NewLeaseOwner()); err != nil && err != structs.ErrLeaseHeld {
+			log.Printf("Cannot delete user %s: %s", deletion.UserID, err)
+		}
+	}()
+	c.IndentedJSON(http.StatusAccepted, gin.H{"userID": deletion.UserID, "status": deletion.Status, "requestedAt": deletion.RequestedAt})
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Returns the status code of an error from changing a team.
+func teamStatus(err error) int {
+	switch err {
+	case structs.ErrTeamNotFound:
+		return http.StatusNotFound
+	case structs.ErrTeamForbidden:
+		return http.StatusForbidden
+	case structs.ErrAlreadyInTeam, structs.ErrTeamFull, structs.ErrTeamChanged:
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// Fetches the user in the path and their team. Responds with an error and
+// returns false if either does not exist.
+func fetchUserTeam(c *gin.Context, db *dynamodb.DynamoDB) (structs.User, structs.Team, bool) {
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return user, structs.Team{}, false
+	}
+	if user.TeamID == "" {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "User is not in a team."})
+		return user, structs.Team{}, false
+	}
+	team := structs.Team{ID: user.TeamID}
+	if err := team.Fetch(db); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return user, team, false
+	}
+	return user, team, true
+}
+
+// Creates a team with the user as its owner.
+func CreateTeam(c *gin.Context) {
+	var body struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	team, err := structs.CreateTeam(db, &user, body.Name, time.Now().UTC())
+	if err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusCreated, team)
+}
+
+// Adds the user to a team as a member.
+func JoinTeam(c *gin.Context) {
+	var body struct {
+		TeamID string `json:"teamID" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user := structs.User{ID: c.Param("id")}
+	if err := user.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	team := structs.Team{ID: body.TeamID}
+	if err := team.Fetch(db); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	if err := team.Join(db, &user, time.Now().UTC()); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, team)
+}
+
+// Removes the user from their team.
+func LeaveTeam(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user, team, ok := fetchUserTeam(c, db)
+	if !ok {
+		return
+	}
+	if err := team.Leave(db, user.ID); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Changes the role of a member of the user's team. Only the owner can change roles.
+func SetTeamMemberRole(c *gin.Context) {
+	var body struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user, team, ok := fetchUserTeam(c, db)
+	if !ok {
+		return
+	}
+	if err := team.SetMemberRole(db, user.ID, c.Param("memberID"), body.Role); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, team)
+}
+
+// Removes a member from the user's team.
+func KickTeamMember(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user, team, ok := fetchUserTeam(c, db)
+	if !ok {
+		return
+	}
+	if err := team.Kick(db, user.ID, c.Param("memberID")); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Enters the user's team into a team tournament.
+func EnterTeamTournament(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	user, team, ok := fetchUserTeam(c, db)
+	if !ok {
+		return
+	}
+	t := structs.Tournament{ID: c.Param("tournamentID")}
+	if err := t.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	if err := team.EnterTournament(db, t, user.ID); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, team.Tournaments[t.ID])
+}
+
+// Returns a given team.
+func GetTeam(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	team := structs.Team{ID: c.Param("teamID")}
+	if err := team.Fetch(db); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, team)
+}
+
+// Returns the ranking of the team's group in a team tournament and the points
+// each member contributed.
+func GetTeamTournament(c *gin.Context) {
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	team := structs.Team{ID: c.Param("teamID")}
+	if err := team.Fetch(db); err != nil {
+		c.IndentedJSON(teamStatus(err), gin.H{"message": err.Error()})
+		return
+	}
+	details, ok := team.Tournaments[c.Param("tournamentID")]
+	if !ok {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Team is not in the tournament."})
+		return
+	}
+	group := structs.Group{TournamentID: c.Param("tournamentID"), GroupID: details.GroupID}
+	if err := group.Fetch(db); err != nil {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": err.Error()})
+		return
+	}
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"groupID":       details.GroupID,
+		"ranking":       group.Ranking(),
+		"contributions": details.Contributions,
+	})
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"oguzhanakan0/good-blast-api/structs"
+)
+
+var ErrCannotSendCode = errors.New("Codes cannot be sent to this kind of identity.")
+
+// Delivers verification codes to the owner of an identity, e.g. by email.
+type CodeSender interface {
+	Send(identity structs.Identity, code string) error
+}
+
+// Writes codes to the log instead of sending them, for development without a
+// mail service. Only email identities receive codes.
+type LogSender struct{}
+
+func (LogSender) Send(identity structs.Identity, code string) error {
+	if identity.Kind != structs.IdentityKindEmail {
+		return ErrCannotSendCode
+	}
+	log.Printf("Verification code for %s: %s", identity.Value, code)
+	return nil
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"oguzhanakan0/good-blast-api/structs"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/gin-gonic/gin"
+)
+
+// Stores the signer, the API keys and the code sender in the context for
+// Authenticate and the auth handlers. API keys map a key to the role it grants.
+func Middleware(signer *Signer, apiKeys map[string]string, sender CodeSender) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("signer", signer)
+		c.Set("apiKeys", apiKeys)
+		c.Set("sender", sender)
+		c.Next()
+	}
+}
+
+// Returns an error if an API key grants a role that does not exist.
+func ValidateAPIKeys(apiKeys map[string]string) error {
+	for _, role := range apiKeys {
+		if !slices.Contains(structs.Roles, role) {
+			return fmt.Errorf("API key has an unknown role: %s", role)
+		}
+	}
+	return nil
+}
+
+// Requires a valid access token in the Authorization header, or an API key in
+// the X-API-Key header, and stores the caller's user ID, session ID and role in
+// the context. Callers with an API key have no user ID.
+func Authenticate(c *gin.Context) {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		apiKeys, _ := c.MustGet("apiKeys").(map[string]string)
+		role, ok := apiKeys[key]
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "API key is not valid."})
+			return
+		}
+		c.Set("role", role)
+		c.Next()
+		return
+	}
+
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Missing bearer token."})
+		return
+	}
+	db, _ := c.MustGet("db").(*dynamodb.DynamoDB)
+	signer, _ := c.MustGet("signer").(*Signer)
+	claims, _, err := signer.Authenticate(db, token, TokenTypeAccess, time.Now().UTC())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": err.Error()})
+		return
+	}
+	role := claims.Role
+	if role == "" {
+		role = structs.RolePlayer
+	}
+	c.Set("userID", claims.Subject)
+	c.Set("sessionID", claims.SessionID)
+	c.Set("role", role)
+	c.Next()
+}
+
+// Only lets the authenticated user access routes of their own :id. Admins can
+// access every user and support can read every user.
+func RequireSelf(c *gin.Context) {
+	role := c.GetString("role")
+	canRead := role == structs.RoleSupport && c.Request.Method == http.MethodGet
+	if c.GetString("userID") != c.Param("id") && role != structs.RoleAdmin && !canRead {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Cannot access another user."})
+		return
+	}
+	c.Next()
+}
+
+// Only lets callers with one of the roles through. Must run after Authenticate.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !slices.Contains(roles, c.GetString("role")) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Insufficient permissions."})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"oguzhanakan0/good-blast-api/structs"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRole(t *testing.T) {
+	r := gin.New()
+	r.Use(Middleware(&Signer{Key: []byte("test-key")}, map[string]string{
+		"support-key": structs.RoleSupport,
+		"admin-key":   structs.RoleAdmin,
+	}, LogSender{}))
+	r.GET("/all", Authenticate, RequireRole(structs.RoleSupport, structs.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/cancel", Authenticate, RequireRole(structs.RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		method string
+		path   string
+		key    string
+		code   int
+	}{
+		{"GET", "/all", "", http.StatusUnauthorized},
+		{"GET", "/all", "wrong-key", http.StatusUnauthorized},
+		{"GET", "/all", "support-key", http.StatusOK},
+		{"GET", "/all", "admin-key", http.StatusOK},
+		{"POST", "/cancel", "support-key", http.StatusForbidden},
+		{"POST", "/cancel", "admin-key", http.StatusOK},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		if test.key != "" {
+			req.Header.Set("X-API-Key", test.key)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.code, w.Code, "%s %s with %q", test.method, test.path, test.key)
+	}
+}
+
+func TestRequireSelf(t *testing.T) {
+	r := gin.New()
+	r.Use(Middleware(&Signer{Key: []byte("test-key")}, map[string]string{
+		"player-key":  structs.RolePlayer,
+		"support-key": structs.RoleSupport,
+		"admin-key":   structs.RoleAdmin,
+	}, LogSender{}))
+	user := r.Group("/user/:id", Authenticate, RequireSelf)
+	user.GET("", func(c *gin.Context) { c.Status(http.StatusOK) })
+	user.GET("/export", func(c *gin.Context) { c.Status(http.StatusOK) })
+	user.PATCH("", func(c *gin.Context) { c.Status(http.StatusOK) })
+	user.DELETE("", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		method string
+		path   string
+		key    string
+		code   int
+	}{
+		{"GET", "/user/1", "player-key", http.StatusForbidden},
+		{"GET", "/user/1", "support-key", http.StatusOK},
+		{"GET", "/user/1/export", "support-key", http.StatusOK},
+		{"PATCH", "/user/1", "support-key", http.StatusForbidden},
+		{"DELETE", "/user/1", "support-key", http.StatusForbidden},
+		{"PATCH", "/user/1", "admin-key", http.StatusOK},
+		{"DELETE", "/user/1", "admin-key", http.StatusOK},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, test.path, nil)
+		req.Header.Set("X-API-Key", test.key)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, test.code, w.Code, "%s %s with %q", test.method, test.path, test.key)
+	}
+}
+
+func TestValidateAPIKeys(t *testing.T) {
+	assert.Nil(t, ValidateAPIKeys(map[string]string{"support-key": structs.RoleSupport, "admin-key": structs.RoleAdmin}))
+	assert.NotNil(t, ValidateAPIKeys(map[string]string{"admin-key": "Admin"}))
+	assert.NotNil(t, ValidateAPIKeys(map[string]string{"empty-key": ""}))
+}
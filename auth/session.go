@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Tokens returned to the client after logging in or refreshing.
+type Tokens struct {
+	UserID       string `json:"userID"`
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresAt    int64  `json:"expiresAt"` // unix seconds, expiry of the access token
+}
+
+// Signs an access and a refresh token for the session.
+func (s *Signer) Issue(session structs.Session, now time.Time) (Tokens, error) {
+	tokens := Tokens{
+		UserID:    session.UserID,
+		ExpiresAt: now.Add(config.AccessTokenMinutes * time.Minute).Unix(),
+	}
+	access, err := s.Sign(Claims{
+		Subject:   session.UserID,
+		SessionID: session.ID,
+		Type:      TokenTypeAccess,
+		Role:      session.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: tokens.ExpiresAt,
+	})
+	if err != nil {
+		return tokens, err
+	}
+	refresh, err := s.Sign(Claims{
+		Subject:   session.UserID,
+		SessionID: session.ID,
+		Type:      TokenTypeRefresh,
+		Role:      session.Role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: session.ExpiresAt,
+	})
+	if err != nil {
+		return tokens, err
+	}
+	tokens.AccessToken = access
+	tokens.RefreshToken = refresh
+	return tokens, nil
+}
+
+// Starts a new session for the user and returns its tokens.
+func (s *Signer) Login(db *dynamodb.DynamoDB, user structs.User, now time.Time) (Tokens, error) {
+	session := structs.NewSession(user.ID, user.Role, now, config.RefreshTokenDays*24*time.Hour)
+	if _, err := session.Put(db); err != nil {
+		return Tokens{}, err
+	}
+	return s.Issue(session, now)
+}
+
+// Verifies a token of the given type and checks that its session is still
+// active. Returns the claims and the session.
+func (s *Signer) Authenticate(db *dynamodb.DynamoDB, token string, tokenType string, now time.Time) (Claims, structs.Session, error) {
+	claims, err := s.Verify(token, now)
+	if err != nil {
+		return claims, structs.Session{}, err
+	}
+	if claims.Type != tokenType {
+		return claims, structs.Session{}, ErrInvalidToken
+	}
+	session := structs.Session{ID: claims.SessionID, UserID: claims.Subject}
+	if err := session.Fetch(db); err != nil {
+		return claims, session, structs.ErrSessionRevoked
+	}
+	if session.UserID != claims.Subject {
+		return claims, session, ErrInvalidToken
+	}
+	return claims, session, session.Check(now)
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+var (
+	ErrInvalidToken = errors.New("Token is not valid.")
+	ErrExpiredToken = errors.New("Token has expired.")
+)
+
+// Claims carried in a token. Tokens are JWTs signed with HMAC-SHA256.
+type Claims struct {
+	Subject   string `json:"sub"` // user ID
+	SessionID string `json:"sid"`
+	Type      string `json:"typ"` // TokenTypeAccess or TokenTypeRefresh
+	Role      string `json:"role,omitempty"`
+	IssuedAt  int64  `json:"iat"` // unix seconds
+	ExpiresAt int64  `json:"exp"` // unix seconds
+}
+
+// Signs and verifies tokens with a single secret key.
+type Signer struct {
+	Key []byte
+}
+
+var header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Returns a signed token for the claims.
+func (s *Signer) Sign(claims Claims) (string, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	payload := header + "." + base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + s.sign(payload), nil
+}
+
+// Checks the signature and expiry of the token and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != header {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(s.sign(parts[0]+"."+parts[1]))) {
+		return claims, ErrInvalidToken
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(b, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+	return claims, nil
+}
@@ -0,0 +1,51 @@
+package auth
+
+import (
+	"oguzhanakan0/good-blast-api/structs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	signer := Signer{Key: []byte("test-key")}
+	claims := Claims{Subject: "user", SessionID: "session", Type: TokenTypeAccess, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Minute).Unix()}
+	token, err := signer.Sign(claims)
+	assert.Nil(t, err)
+
+	verified, err := signer.Verify(token, now)
+	assert.Nil(t, err)
+	assert.Equal(t, claims, verified)
+
+	// Expired tokens are rejected
+	_, err = signer.Verify(token, now.Add(time.Minute))
+	assert.Equal(t, ErrExpiredToken, err)
+
+	// Tokens signed with another key are rejected
+	other := Signer{Key: []byte("other-key")}
+	_, err = other.Verify(token, now)
+	assert.Equal(t, ErrInvalidToken, err)
+}
+
+func TestIssue(t *testing.T) {
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	signer := Signer{Key: []byte("test-key")}
+	session := structs.NewSession("user", structs.RoleSupport, now, time.Hour)
+	tokens, err := signer.Issue(session, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "user", tokens.UserID)
+
+	access, err := signer.Verify(tokens.AccessToken, now)
+	assert.Nil(t, err)
+	assert.Equal(t, TokenTypeAccess, access.Type)
+	assert.Equal(t, structs.RoleSupport, access.Role)
+	assert.Equal(t, session.ID, access.SessionID)
+	assert.Equal(t, tokens.ExpiresAt, access.ExpiresAt)
+
+	refresh, err := signer.Verify(tokens.RefreshToken, now)
+	assert.Nil(t, err)
+	assert.Equal(t, TokenTypeRefresh, refresh.Type)
+	assert.Equal(t, session.ExpiresAt, refresh.ExpiresAt)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"oguzhanakan0/good-blast-api/store"
+	"oguzhanakan0/good-blast-api/structs"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func createTables(db *dynamodb.DynamoDB, args []string) error {
+	return store.CreateTables(db)
+}
+
+func seed(db *dynamodb.DynamoDB, args []string) error {
+	return store.Seed(db)
+}
+
+func migrateCountries(db *dynamodb.DynamoDB, args []string) error {
+	migration, err := structs.MigrateCountries(db)
+	printJSON(migration)
+	return err
+}
+
+func migrateUsernames(db *dynamodb.DynamoDB, args []string) error {
+	migration, err := structs.MigrateUsernames(db)
+	printJSON(migration)
+	return err
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/store"
+	"os"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const usage = `Usage: goodblast <command> <subcommand> [flags] [args]
+
+Commands:
+  tournament create --id <id> [--start <time>] [--end <time>] [--auto-rewards] [--claim-window <hours>] [--scoring <policy>] [--team]
+  tournament finalize <id> [--dry-run] [--top <n>]
+  tournament diff <id>
+  tournament backfill [--from <id>] [--to <id>] [--force] [<id>...]
+  tournament cancel <id>
+  user show <id>
+  user grant-coins --amount <amount> <id>
+  user set-role --role <role> <id>
+  user verify-identity --kind <kind> --value <value> <id>
+  user export <id>
+  user delete <id>
+  db create-tables
+  db seed
+  db migrate-countries
+  db migrate-usernames
+`
+
+type command func(db *dynamodb.DynamoDB, args []string) error
+
+var commands = map[string]map[string]command{
+	"tournament": {
+		"create":   createTournament,
+		"finalize": finalizeTournament,
+		"diff":     diffTournament,
+		"backfill": backfillTournaments,
+		"cancel":   cancelTournament,
+	},
+	"user": {
+		"show":            showUser,
+		"grant-coins":     grantCoins,
+		"set-role":        setRole,
+		"verify-identity": verifyIdentity,
+		"export":          exportUser,
+		"delete":          deleteUser,
+	},
+	"db": {
+		"create-tables":     createTables,
+		"seed":              seed,
+		"migrate-countries": migrateCountries,
+		"migrate-usernames": migrateUsernames,
+	},
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]][os.Args[2]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s %s\n\n%s", os.Args[1], os.Args[2], usage)
+		os.Exit(2)
+	}
+	db := store.New(config.LoadEnv())
+	if err := cmd(db, os.Args[3:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// Parses flags that may appear before, after or between positional arguments,
+// and returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func printJSON(v interface{}) {
+	b, _ := json.MarshalIndent(v, "", "    ")
+	fmt.Println(string(b))
+}
+
+// Returns the only positional argument, or an error naming what is missing.
+func singleArg(fs *flag.FlagSet, args []string, name string) (string, error) {
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		return "", fmt.Errorf("Expected exactly one argument: <%s>", name)
+	}
+	return positional[0], nil
+}
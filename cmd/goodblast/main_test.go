@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "")
+	positional, err := parseArgs(fs, []string{"2000-01-01", "--dry-run"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2000-01-01"}, positional)
+	assert.True(t, *dryRun)
+}
+
+func TestTournamentRange(t *testing.T) {
+	ids, err := tournamentRange("2000-02-28", "2000-03-01")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2000-02-28", "2000-02-29", "2000-03-01"}, ids)
+}
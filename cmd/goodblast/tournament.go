@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func createTournament(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("tournament create", flag.ExitOnError)
+	id := fs.String("id", "", "tournament ID (YYYY-MM-DD)")
+	start := fs.String("start", "", "start time in RFC3339, defaults to the midnight of the tournament day")
+	end := fs.String("end", "", "end time in RFC3339, defaults to the midnight after the tournament day")
+	claimWindow := fs.Int("claim-window", 0, "hours to claim rewards after the tournament ends, defaults to config.RewardClaimWindowHours")
+	scoring := fs.String("scoring", config.TournamentScoring, "scoring policy: flat, level-weighted, stars or streak")
+	autoRewards := fs.Bool("auto-rewards", config.TournamentAutoRewards, "fix every player's reward at finalization")
+	team := fs.Bool("team", false, "create a team tournament, its ID is prefixed with "+structs.TeamTournamentPrefix)
+	if _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+	if *id == "" {
+		return errors.New("--id is required")
+	}
+	if _, err := time.Parse(structs.TournamentIDLayout, *id); err != nil {
+		return errors.New("--id must be a date (YYYY-MM-DD)")
+	}
+	for _, v := range []string{*start, *end} {
+		if _, err := time.Parse(time.RFC3339, v); v != "" && err != nil {
+			return fmt.Errorf("%s is not an RFC3339 time", v)
+		}
+	}
+
+	if _, err := structs.GetScoringPolicy(*scoring); err != nil {
+		return err
+	}
+
+	t := structs.Tournament{ID: *id, Start: *start, End: *end, AutoRewards: *autoRewards, ClaimWindow: *claimWindow, Scoring: *scoring, Team: *team}
+	if t.Team {
+		t.ID = structs.TeamTournamentPrefix + t.ID
+	}
+	created, err := t.Create(db)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return fmt.Errorf("Tournament %s already exists", t.ID)
+	}
+	fmt.Printf("Inserted tournament for %s\n", t.ID)
+	return nil
+}
+
+func finalizeTournament(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("tournament finalize", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "calculate the results without saving them")
+	top := fs.Int("top", 10, "number of top players to show in a dry run")
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	t := structs.Tournament{ID: id}
+	err = t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	if t.Cancelled {
+		return fmt.Errorf("Tournament %s is cancelled", t.ID)
+	}
+
+	if *dryRun {
+		groups, err := t.FetchGroups(db)
+		if err != nil {
+			return err
+		}
+		printJSON(structs.SummarizeTournament(&t, groups, *top))
+		return nil
+	}
+
+	if t.Completed {
+		fmt.Printf("Results had already been calculated for tournament %s\n", t.ID)
+		return nil
+	}
+	err = t.Finalize(db, structs.NewLeaseOwner())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Results are calculated for tournament %s\n", t.ID)
+	return nil
+}
+
+func cancelTournament(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("tournament cancel", flag.ExitOnError)
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	t := structs.Tournament{ID: id}
+	err = t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	err = t.Cancel(db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Cancelled tournament %s\n", t.ID)
+	return nil
+}
+
+// Recalculates the leaderboards of a completed tournament and prints the positions
+// that differ from the stored leaderboards. Nothing is saved.
+func diffTournament(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("tournament diff", flag.ExitOnError)
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	t := structs.Tournament{ID: id}
+	err = t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	if !t.Completed {
+		return fmt.Errorf("Tournament %s has not been completed yet", t.ID)
+	}
+	leaderboards, err := t.ComputeLeaderboards(db)
+	if err != nil {
+		return err
+	}
+	changes := structs.DiffLeaderboards(t.Leaderboards, leaderboards)
+	if len(changes) == 0 {
+		fmt.Printf("Stored leaderboards of tournament %s are up to date\n", t.ID)
+		return nil
+	}
+	printJSON(changes)
+	return nil
+}
+
+// Outcome of backfilling a single tournament.
+type backfillResult struct {
+	TournamentID string                      `json:"tournamentID"`
+	Status       string                      `json:"status"` // finalized, recalculated, skipped or failed
+	Changes      []structs.LeaderboardChange `json:"changes,omitempty"`
+	Error        string                      `json:"error,omitempty"`
+}
+
+// Calculates the results of the given tournaments, or of every tournament between
+// --from and --to. Completed tournaments are skipped unless --force is given.
+func backfillTournaments(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("tournament backfill", flag.ExitOnError)
+	from := fs.String("from", "", "first tournament ID of the range (YYYY-MM-DD)")
+	to := fs.String("to", "", "last tournament ID of the range (YYYY-MM-DD), defaults to yesterday")
+	force := fs.Bool("force", false, "recalculate completed tournaments")
+	ids, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *from != "" {
+		if len(ids) > 0 {
+			return errors.New("Either give tournament IDs or --from, not both")
+		}
+		ids, err = tournamentRange(*from, *to)
+		if err != nil {
+			return err
+		}
+	}
+	if len(ids) == 0 {
+		return errors.New("Expected tournament IDs or --from")
+	}
+
+	owner := structs.NewLeaseOwner()
+	now := time.Now().UTC()
+	var results []backfillResult
+	for _, id := range ids {
+		result := backfillResult{TournamentID: id}
+		t := structs.Tournament{ID: id}
+		if err := t.Fetch(db); err != nil {
+			result.Status, result.Error = "failed", err.Error()
+			results = append(results, result)
+			continue
+		}
+		endsAt, err := t.EndsAt()
+		switch {
+		case t.Cancelled:
+			result.Status = "skipped"
+			result.Error = "Tournament is cancelled."
+		case err == nil && now.Before(endsAt):
+			result.Status = "skipped"
+			result.Error = "Tournament has not ended yet."
+		case t.Completed && !*force:
+			result.Status = "skipped"
+			result.Error = "Tournament is already completed, use --force to recalculate."
+		case t.Completed:
+			result.Changes, err = t.Refinalize(db, owner)
+			result.Status = "recalculated"
+		default:
+			err = t.Finalize(db, owner)
+			result.Status = "finalized"
+		}
+		if err != nil {
+			result.Status, result.Error = "failed", err.Error()
+		}
+		results = append(results, result)
+	}
+	printJSON(results)
+	return nil
+}
+
+// Returns the IDs of the tournaments from the first to the last day, both included.
+func tournamentRange(from string, to string) ([]string, error) {
+	start, err := time.Parse(structs.TournamentIDLayout, from)
+	if err != nil {
+		return nil, errors.New("--from must be a date (YYYY-MM-DD)")
+	}
+	end := time.Now().UTC().AddDate(0, 0, -1)
+	if to != "" {
+		end, err = time.Parse(structs.TournamentIDLayout, to)
+		if err != nil {
+			return nil, errors.New("--to must be a date (YYYY-MM-DD)")
+		}
+	}
+	var ids []string
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		ids = append(ids, day.Format(structs.TournamentIDLayout))
+	}
+	return ids, nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"oguzhanakan0/good-blast-api/structs"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func showUser(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user show", flag.ExitOnError)
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	u := structs.User{ID: id}
+	err = u.Fetch(db)
+	if err != nil {
+		return err
+	}
+	printJSON(u)
+	return nil
+}
+
+func grantCoins(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user grant-coins", flag.ExitOnError)
+	amount := fs.Int("amount", 0, "number of coins to grant, negative to take coins")
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+	if *amount == 0 {
+		return errors.New("--amount is required")
+	}
+
+	u := structs.User{ID: id}
+	err = u.Fetch(db)
+	if err != nil {
+		return err
+	}
+	err = u.AddCoins(db, structs.NewLedgerEntry(u.ID, structs.LedgerReasonAdminGrant, *amount, ""))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %s has %d coins\n", u.ID, u.Coins)
+	return nil
+}
+
+func setRole(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user set-role", flag.ExitOnError)
+	role := fs.String("role", "", "player, support or admin")
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+	if *role == "" {
+		return errors.New("--role is required")
+	}
+
+	u := structs.User{ID: id}
+	err = u.SetRole(db, *role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %s is now %s\n", u.ID, u.Role)
+	return nil
+}
+
+func verifyIdentity(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user verify-identity", flag.ExitOnError)
+	kind := fs.String("kind", "", "email or platform")
+	value := fs.String("value", "", "email address or platform account ID")
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	identity, err := structs.ParseIdentity(*kind, *value)
+	if err != nil {
+		return err
+	}
+	err = identity.Verify(db, id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Identity %s of user %s is verified\n", identity.ID, id)
+	return nil
+}
+
+func deleteUser(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user delete", flag.ExitOnError)
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	// Resume the deletion if it was already requested
+	d := structs.Deletion{UserID: id}
+	if err := d.Fetch(db); err != nil {
+		u := structs.User{ID: id}
+		err = u.Fetch(db)
+		if err != nil {
+			return err
+		}
+		d, err = structs.RequestDeletion(db, u)
+		if err != nil {
+			return err
+		}
+	}
+	err = d.Run(db, structs.NewLeaseOwner())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("User %s is deleted\n", id)
+	return nil
+}
+
+func exportUser(db *dynamodb.DynamoDB, args []string) error {
+	fs := flag.NewFlagSet("user export", flag.ExitOnError)
+	id, err := singleArg(fs, args, "id")
+	if err != nil {
+		return err
+	}
+
+	export, err := structs.ExportUser(db, id)
+	if err != nil {
+		return err
+	}
+	printJSON(export)
+	return nil
+}
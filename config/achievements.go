@@ -0,0 +1,9 @@
+package config
+
+import _ "embed"
+
+// Definitions of the achievements, used unless ACHIEVEMENTS_FILE points to
+// another file. See structs.Achievement for the format.
+//
+//go:embed achievements.json
+var DefaultAchievements []byte
@@ -2,9 +2,13 @@ package config
 
 const (
 	UsernameMinLength          = 3
+	UsernameMaxLength          = 20
+	UsernameRenameCooldownDays = 7
+	TimezoneChangeCooldownDays = 7
 	UserStartLevel             = 1
 	UserStartCoin              = 3000
 	ProgressCoinReward         = 100
+	ProgressStarCoinReward     = 20
 	ProgressLevelReward        = 1
 	ProgressTournamentReward   = 1
 	TournamentCost             = 500
@@ -17,4 +21,63 @@ const (
 	TournamentReward2          = 4000
 	TournamentReward3          = 3000
 	TournamentRewardDefault    = 1000
+	TournamentRewardMaxRank    = 10 // zero-based, players ranked below it earn nothing
+	TournamentAutoRewards      = false
+	TournamentScoring          = "flat"
+	RewardClaimWindowHours     = 24
+	UserMaxLives               = 5
+	LifeRegenMinutes           = 30
+	LifeCost                   = 300
+	LevelMaxMoves              = 50
+	LevelMaxStars              = 3
+	LevelMinSeconds            = 10
+	ScoringLevelStep           = 10
+	ScoringStreakStep          = 3
+	ScoringMaxStreakMultiplier = 3
+	SchedulerDaysAhead         = 1
+	SchedulerDaysBehind        = 7 // days the scheduler looks back for tournaments to finalize
+	SchedulerIntervalMinutes   = 10
+	LeaseDurationSeconds       = 60
+	AccessTokenMinutes         = 15
+	FriendsMaxCount            = 100 // friends and pending requests
+	FriendCodeLength           = 8
+	CountryHeader              = "X-Client-Region" // set by the load balancer from the client's IP address
+	RefreshTokenDays           = 30
+	VerifyCodeLength           = 6
+	VerifyCodeMinutes          = 15
+	VerifyCodeResendSeconds    = 60
+	VerifyCodeMaxAttempts      = 5 // wrong codes after which a code cannot be used anymore
+	TeamNameMaxLength          = 24
+	TeamMaxSize                = 20
+	TeamGroupMaxLength         = 10
+	LeaguePromotions           = 3 // top players of each group who move up a league
+	LeagueRelegations          = 3 // bottom players of each group who move down a league
+	HistoryPageSize            = 20
+	HistoryMaxPageSize         = 100
 )
+
+// Items earned by finishing a group at each zero-based rank, on top of coins.
+// format: { itemID: quantity }
+var TournamentItemRewards = []map[string]int{
+	{"ticket": 1, "booster-rocket": 2, "frame-gold": 1},
+	{"ticket": 1, "booster-rocket": 1},
+	{"booster-bomb": 1},
+}
+
+// Leagues from the lowest to the highest. Users are seated in groups of their
+// own league in daily tournaments.
+var Leagues = []string{"bronze", "silver", "gold", "platinum", "diamond"}
+
+// Coins of the daily login bonus on each day of a streak. The calendar starts
+// over after the last day.
+var DailyBonusCalendar = []int{100, 150, 200, 300, 400, 500, 1000}
+
+// Avatars a user can choose from.
+var Avatars = []string{"blaster", "bomb", "rocket", "star", "crown", "cat", "dog", "panda"}
+
+// Usernames that contain one of these words are rejected, ignoring case,
+// spaces, symbols and common letter substitutions.
+var UsernameBlocklist = []string{
+	"admin", "moderator", "goodblast", "support",
+	"fuck", "shit", "bitch", "cunt", "asshole", "pussy", "whore", "slut",
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// Signing key used outside release mode when AUTH_SIGNING_KEY is not set.
+const devSigningKey = "good-blast-dev-signing-key"
+
+// Settings that are read from the environment.
+type Env struct {
+	Release        bool              // true if the app runs in release mode (GIN_MODE=release)
+	DynamoDBHost   string            // endpoint of the local DynamoDB, ignored in release mode
+	AuthSigningKey string            // secret used to sign session tokens, required in release mode
+	APIKeys        map[string]string // format: { key: role }, from API_KEYS=key:role,key:role
+	Achievements   string            // path of the achievement definitions, DefaultAchievements if empty
+}
+
+func LoadEnv() Env {
+	env := Env{
+		Release:        os.Getenv("GIN_MODE") == "release",
+		DynamoDBHost:   "http://localhost:8000",
+		AuthSigningKey: os.Getenv("AUTH_SIGNING_KEY"),
+		APIKeys:        map[string]string{},
+		Achievements:   os.Getenv("ACHIEVEMENTS_FILE"),
+	}
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		env.DynamoDBHost = os.Getenv("DYNAMODB_HOST")
+	}
+	if env.AuthSigningKey == "" && !env.Release {
+		env.AuthSigningKey = devSigningKey
+	}
+	for _, pair := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		key, role, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if ok && key != "" {
+			env.APIKeys[key] = role
+		}
+	}
+	return env
+}
@@ -0,0 +1,13 @@
+package main
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/scheduler"
+	"oguzhanakan0/good-blast-api/store"
+)
+
+func main() {
+	db := store.New(config.LoadEnv())
+
+	scheduler.Run(db)
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"log"
 	"oguzhanakan0/good-blast-api/api"
+	"oguzhanakan0/good-blast-api/auth"
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/scheduler"
+	"oguzhanakan0/good-blast-api/store"
+	"oguzhanakan0/good-blast-api/structs"
 	"os"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gin-gonic/gin"
 )
@@ -19,34 +23,89 @@ func dbMiddleware(db *dynamodb.DynamoDB) gin.HandlerFunc {
 
 func main() {
 	router := gin.Default()
-	sess := session.Must(session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable}))
-	var db *dynamodb.DynamoDB
-	// Set to local DynamoDB if not in release
-	if gin.Mode() == "release" {
-		db = dynamodb.New(sess)
-	} else {
-		host := "http://localhost:8000"
-		if os.Getenv("DYNAMODB_HOST") != "" {
-			host = os.Getenv("DYNAMODB_HOST")
-		}
-		db = dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	env := config.LoadEnv()
+	if env.AuthSigningKey == "" {
+		log.Fatal("AUTH_SIGNING_KEY must be set in release mode.")
+	}
+	if err := auth.ValidateAPIKeys(env.APIKeys); err != nil {
+		log.Fatal(err)
+	}
+	if err := structs.LoadAchievements(env.Achievements); err != nil {
+		log.Fatal(err)
+	}
+	db := store.New(env)
+	// Run the tournament scheduler in the background if enabled
+	if os.Getenv("SCHEDULER_ENABLED") == "true" {
+		go scheduler.Run(db)
 	}
 	router.Use(dbMiddleware(db))
+	// Codes are logged until a mail service is set up
+	router.Use(auth.Middleware(&auth.Signer{Key: []byte(env.AuthSigningKey)}, env.APIKeys, auth.LogSender{}))
+	// Listing every record is limited to support and admins
+	readAll := auth.RequireRole(structs.RoleSupport, structs.RoleAdmin)
+	// Auth
+	router.POST("/auth/device", api.DeviceLogin)
+	router.POST("/auth/refresh", api.RefreshToken)
+	router.POST("/auth/logout", auth.Authenticate, api.Logout)
+	router.POST("/auth/identity/code", api.SendLoginCode)
+	router.POST("/auth/identity", api.IdentityLogin)
 	// User
-	router.POST("/user", api.CreateUser)                                         //
-	router.GET("/user/:id", api.GetUser)                                         //
-	router.GET("/user/all", api.GetUsers)                                        //
-	router.POST("/user/:id/progress", api.UpdateProgress)                        //
-	router.POST("/user/:id/tournament/:tournamentID/enter", api.EnterTournament) //
-	router.GET("/user/:id/tournament/:tournamentID/leaderboard", api.GetUserLeaderboard)
-	router.POST("/user/:id/tournament/:tournamentID/claim-reward", api.ClaimReward)
+	router.POST("/user", api.CreateUser)                              //
+	router.GET("/user/all", auth.Authenticate, readAll, api.GetUsers) //
+	user := router.Group("/user/:id", auth.Authenticate, auth.RequireSelf)
+	user.GET("", api.GetUser) //
+	user.PATCH("", api.UpdateUser)
+	user.DELETE("", api.DeleteUser)
+	user.GET("/export", api.ExportUser)
+	user.POST("/progress", api.UpdateProgress)                        //
+	user.POST("/tournament/:tournamentID/enter", api.EnterTournament) //
+	user.GET("/tournament/:tournamentID/leaderboard", api.GetUserLeaderboard)
+	user.GET("/tournament/:tournamentID/friends-leaderboard", api.GetFriendsLeaderboard)
+	user.POST("/tournament/:tournamentID/claim-reward", api.ClaimReward)
+	user.GET("/rewards", api.GetRewards)
+	user.GET("/tournaments", api.GetTournamentHistory)
+	user.GET("/inventory", api.GetInventory)
+	user.GET("/lives", api.GetLives)
+	user.POST("/daily-bonus", api.ClaimDailyBonus)
+	user.GET("/achievements", api.GetAchievements)
+	user.POST("/lives/buy", api.BuyLives)
+	user.POST("/level/start", api.StartLevel)
+	user.POST("/level/finish", api.FinishLevel)
+	user.POST("/inventory/:item/consume", api.ConsumeItem)
+	user.GET("/rewards/unclaimed", api.GetUnclaimedRewards)
+	user.POST("/rewards/:tournamentID/claim", api.ClaimReward)
+	user.GET("/identities", api.GetIdentities)
+	user.POST("/identities", api.LinkIdentity)
+	user.DELETE("/identities/:kind/:value", api.UnlinkIdentity)
+	user.POST("/identities/:kind/:value/code", api.SendIdentityCode)
+	user.POST("/identities/:kind/:value/verify", api.VerifyIdentity)
+	user.POST("/merge", api.MergeUser)
+	user.GET("/friend-code", api.GetFriendCode)
+	user.GET("/friends", api.GetFriends)
+	user.POST("/friends", api.AddFriend)
+	user.POST("/friends/:friendID/accept", api.AcceptFriend)
+	user.DELETE("/friends/:friendID", api.RemoveFriend)
+	user.POST("/team", api.CreateTeam)
+	user.POST("/team/join", api.JoinTeam)
+	user.POST("/team/leave", api.LeaveTeam)
+	user.PUT("/team/members/:memberID/role", api.SetTeamMemberRole)
+	user.DELETE("/team/members/:memberID", api.KickTeamMember)
+	user.POST("/team/tournament/:tournamentID/enter", api.EnterTeamTournament)
+	// Identity
+	router.GET("/identity/:kind/:value", auth.Authenticate, readAll, api.GetIdentityUser)
 	// Tournament
-	router.GET("/tournament/:id", api.GetTournament)  //
-	router.GET("/tournament/all", api.GetTournaments) //
+	router.GET("/tournament/:id", api.GetTournament)                              //
+	router.GET("/tournament/all", auth.Authenticate, readAll, api.GetTournaments) //
 	router.GET("/tournament/:id/leaderboard/:countryCode", api.GetLeaderboard)
+	router.POST("/tournament/:id/cancel", auth.Authenticate, auth.RequireRole(structs.RoleAdmin), api.CancelTournament)
+	// Team
+	router.GET("/team/:teamID", api.GetTeam)
+	router.GET("/team/:teamID/tournament/:tournamentID", api.GetTeamTournament)
+	// Country
+	router.GET("/countries", api.GetCountries)
 	// Group
 	router.GET("/group/:tournamentID/:groupID", api.GetGroup)
-	router.GET("/group/all", api.GetGroups)
+	router.GET("/group/all", auth.Authenticate, readAll, api.GetGroups)
 
 	router.Run(":8080")
 }
@@ -7,9 +7,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"oguzhanakan0/good-blast-api/api"
+	"oguzhanakan0/good-blast-api/auth"
 	"oguzhanakan0/good-blast-api/config"
 	"oguzhanakan0/good-blast-api/structs"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -25,6 +29,17 @@ func setupRouter() *gin.Engine {
 	return r
 }
 
+// Stores a signer in the context, so that handlers that log users in can sign tokens.
+func testAuth() gin.HandlerFunc {
+	return auth.Middleware(&auth.Signer{Key: []byte("test")}, nil, auth.LogSender{})
+}
+
+// Returns a username that is not taken by an earlier test run, as usernames
+// are unique.
+func testUsername() string {
+	return "TestUser#" + (uuid.New()).String()[:8]
+}
+
 func TestCreateUser(t *testing.T) {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
@@ -36,10 +51,12 @@ func TestCreateUser(t *testing.T) {
 	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
 	r := setupRouter()
 	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
 	r.POST("/user", api.CreateUser)
 
 	user := map[string]interface{}{
-		"username": "TestUser#001",
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
 		"country":  "TUR",
 	}
 	jsonValue, _ := json.Marshal(user)
@@ -48,6 +65,12 @@ func TestCreateUser(t *testing.T) {
 	w := httptest.NewRecorder()
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusCreated, w.Code)
+	// The user is logged in with the device
+	var res map[string]interface{}
+	b, _ := io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+	assert.Equal(t, res["id"], res["userID"])
+	assert.NotEmpty(t, res["accessToken"])
 }
 
 func TestGetUser(t *testing.T) {
@@ -61,11 +84,13 @@ func TestGetUser(t *testing.T) {
 	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
 	r := setupRouter()
 	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
 	r.POST("/user", api.CreateUser)
 	r.GET("/user/:id", api.GetUser)
 
 	user := map[string]interface{}{
-		"username": "TestUser#002",
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
 		"country":  "TUR",
 	}
 	jsonValue, _ := json.Marshal(user)
@@ -85,6 +110,67 @@ func TestGetUser(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestUpdateUser(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
+	r.POST("/user", api.CreateUser)
+	r.PATCH("/user/:id", api.UpdateUser)
+
+	username := testUsername()
+	user := map[string]interface{}{
+		"username": username,
+		"deviceID": (uuid.New()).String(),
+		"country":  "TUR",
+	}
+	jsonValue, _ := json.Marshal(user)
+	req, _ := http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var res map[string]interface{}
+	b, _ := io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+
+	// Usernames are unique regardless of case
+	user["username"] = strings.ToLower(username)
+	user["deviceID"] = (uuid.New()).String()
+	jsonValue, _ = json.Marshal(user)
+	req, _ = http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Rename, then rename again within the cooldown
+	req, _ = http.NewRequest("PATCH", "/user/"+res["id"].(string), bytes.NewBuffer([]byte(`{"username": "`+testUsername()+`"}`)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("PATCH", "/user/"+res["id"].(string), bytes.NewBuffer([]byte(`{"username": "`+testUsername()+`"}`)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	// Other fields can still be changed
+	req, _ = http.NewRequest("PATCH", "/user/"+res["id"].(string), bytes.NewBuffer([]byte(`{"country": "us", "avatar": "cat"}`)))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	b, _ = io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+	assert.Equal(t, "US", res["country"])
+	assert.Equal(t, "cat", res["avatar"])
+}
+
 func TestGetUsers(t *testing.T) {
 	sess := session.Must(session.NewSessionWithOptions(session.Options{
 		SharedConfigState: session.SharedConfigEnable,
@@ -117,11 +203,14 @@ func TestProgressUser(t *testing.T) {
 	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
 	r := setupRouter()
 	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
 	r.POST("/user", api.CreateUser)
 	r.POST("/user/:id/progress", api.UpdateProgress)
+	r.POST("/user/:id/level/start", api.StartLevel)
 
 	user := map[string]interface{}{
-		"username": "TestUser#003",
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
 		"country":  "TUR",
 	}
 	jsonValue, _ := json.Marshal(user)
@@ -135,10 +224,34 @@ func TestProgressUser(t *testing.T) {
 	b, _ := io.ReadAll(w.Body)
 	json.Unmarshal(b, &res)
 
+	// Progress without a result is rejected
 	req, _ = http.NewRequest("POST", "/user/"+res["id"]+"/progress", bytes.NewBuffer([]byte{}))
 	w = httptest.NewRecorder()
 	r.ServeHTTP(w, req)
-	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Start the level
+	req, _ = http.NewRequest("POST", "/user/"+res["id"]+"/level/start", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var attempt map[string]interface{}
+	b, _ = io.ReadAll(w.Body)
+	json.Unmarshal(b, &attempt)
+
+	// Completing the level right after starting it is not plausible
+	result := map[string]interface{}{
+		"attemptID": attempt["id"],
+		"level":     config.UserStartLevel,
+		"moves":     20,
+		"stars":     3,
+		"score":     1000,
+	}
+	jsonValue, _ = json.Marshal(result)
+	req, _ = http.NewRequest("POST", "/user/"+res["id"]+"/progress", bytes.NewBuffer(jsonValue))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 }
 
 func TestEnterTournament(t *testing.T) {
@@ -152,14 +265,14 @@ func TestEnterTournament(t *testing.T) {
 	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
 	r := setupRouter()
 	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
 	r.POST("/user", api.CreateUser)
 	r.POST("/user/:id/tournament/:tournamentID/enter", api.EnterTournament)
 	// Create a test user
 	user := map[string]interface{}{
-		"username":  "TestUser#004",
-		"country":   "TUR",
-		"gameLevel": 20,
-		"coins":     10000,
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
+		"country":  "TUR",
 	}
 	jsonValue, _ := json.Marshal(user)
 	req, _ := http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
@@ -169,6 +282,18 @@ func TestEnterTournament(t *testing.T) {
 	var res map[string]string
 	b, _ := io.ReadAll(w.Body)
 	json.Unmarshal(b, &res)
+	// New users start below the minimum level of tournaments
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(res["id"])},
+		},
+		UpdateExpression: aws.String("SET gameLevel = :level"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":level": {N: aws.String(strconv.Itoa(config.TournamentMinLevel))},
+		},
+	})
+	assert.Nil(t, err)
 	// Create a tournament
 	to := structs.Tournament{
 		ID:        "2000-01-01",
@@ -229,3 +354,281 @@ func TestGetTournaments(t *testing.T) {
 	r.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestCancelTournament(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.POST("/tournament/:id/cancel", api.CancelTournament)
+	// Create a tournament
+	to := structs.Tournament{
+		ID: "2000-01-02",
+	}
+	to.Put(db)
+	// Two players enter, one paying with coins and one with a ticket
+	payments := []string{structs.PaymentCoins, structs.PaymentTicket}
+	var users []structs.User
+	for _, payment := range payments {
+		u := structs.User{
+			ID:        (uuid.New()).String(),
+			Username:  testUsername(),
+			Level:     config.TournamentMinLevel,
+			Coins:     config.UserStartCoin,
+			Inventory: map[string]int{structs.ItemTicket: 1},
+			Role:      structs.RolePlayer,
+		}
+		assert.Nil(t, u.Create(db))
+		assert.Nil(t, u.EnterTournament(db, to, payment))
+		users = append(users, u)
+	}
+	assert.Equal(t, config.UserStartCoin-config.TournamentCost, users[0].Coins)
+	assert.Equal(t, 0, users[1].Inventory[structs.ItemTicket])
+	// Cancel tournament
+	req, _ := http.NewRequest("POST", "/tournament/2000-01-02/cancel", bytes.NewBuffer([]byte{}))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Cancelling again only resumes refunds
+	req, _ = http.NewRequest("POST", "/tournament/2000-01-02/cancel", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// Each player is refunded exactly once, in the way they paid
+	for i, u := range users {
+		assert.Nil(t, u.Fetch(db))
+		assert.Equal(t, config.UserStartCoin, u.Coins)
+		assert.Equal(t, 1, u.Inventory[structs.ItemTicket])
+		assert.True(t, u.Tournaments[to.ID].Refunded)
+		ledger, err := structs.FetchLedger(db, u.ID)
+		assert.Nil(t, err)
+		refunds := 0
+		for _, entry := range ledger {
+			if entry.Reason == structs.LedgerReasonTournamentRefund {
+				refunds++
+				if payments[i] == structs.PaymentTicket {
+					assert.Equal(t, structs.ItemTicket, entry.Item)
+					assert.Equal(t, 1, entry.Amount)
+				} else {
+					assert.Equal(t, config.TournamentCost, entry.Amount)
+				}
+			}
+		}
+		assert.Equal(t, 1, refunds)
+	}
+	// Entries are rejected once the tournament is cancelled
+	late := structs.User{ID: (uuid.New()).String(), Username: testUsername(), Level: config.TournamentMinLevel, Coins: config.UserStartCoin}
+	assert.Nil(t, late.Create(db))
+	assert.Equal(t, structs.ErrTournamentClosed, late.EnterTournament(db, to, structs.PaymentCoins))
+}
+
+func TestGetRewards(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
+	r.POST("/user", api.CreateUser)
+	r.GET("/user/:id/rewards", api.GetRewards)
+
+	user := map[string]interface{}{
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
+		"country":  "TUR",
+	}
+	jsonValue, _ := json.Marshal(user)
+	req, _ := http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var res map[string]string
+	b, _ := io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+	// Get rewards
+	req, _ = http.NewRequest("GET", "/user/"+res["id"]+"/rewards", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGetInventory(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
+	r.POST("/user", api.CreateUser)
+	r.GET("/user/:id/inventory", api.GetInventory)
+	r.POST("/user/:id/inventory/:item/consume", api.ConsumeItem)
+
+	user := map[string]interface{}{
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
+		"country":  "TUR",
+	}
+	jsonValue, _ := json.Marshal(user)
+	req, _ := http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var res map[string]string
+	b, _ := io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+	// Get inventory
+	req, _ = http.NewRequest("GET", "/user/"+res["id"]+"/inventory", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// A new user has no boosters to consume
+	req, _ = http.NewRequest("POST", "/user/"+res["id"]+"/inventory/booster-bomb/consume", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestExportAndDeleteUser(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.Use(testAuth())
+	r.POST("/user", api.CreateUser)
+	r.GET("/user/:id/export", api.ExportUser)
+	r.DELETE("/user/:id", api.DeleteUser)
+
+	user := map[string]interface{}{
+		"username": testUsername(),
+		"deviceID": (uuid.New()).String(),
+		"country":  "TUR",
+	}
+	jsonValue, _ := json.Marshal(user)
+	req, _ := http.NewRequest("POST", "/user", bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var res map[string]interface{}
+	b, _ := io.ReadAll(w.Body)
+	json.Unmarshal(b, &res)
+	id := res["id"].(string)
+
+	// Export
+	req, _ = http.NewRequest("GET", "/user/"+id+"/export", bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Delete, the user is removed in the background
+	req, _ = http.NewRequest("DELETE", "/user/"+id, bytes.NewBuffer([]byte{}))
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	deletion := structs.Deletion{UserID: id}
+	assert.Nil(t, deletion.Fetch(db))
+}
+
+// Keeps the last code sent to each identity, so that tests can use it.
+type testSender map[string]string
+
+func (s testSender) Send(identity structs.Identity, code string) error {
+	s[identity.ID] = code
+	return nil
+}
+
+func TestRecoverAccount(t *testing.T) {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	db := dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+	sender := testSender{}
+	r := setupRouter()
+	r.Use(dbMiddleware(db))
+	r.Use(auth.Middleware(&auth.Signer{Key: []byte("test")}, nil, sender))
+	r.POST("/user", api.CreateUser)
+	r.POST("/user/:id/identities", api.LinkIdentity)
+	r.POST("/user/:id/identities/:kind/:value/code", api.SendIdentityCode)
+	r.POST("/user/:id/identities/:kind/:value/verify", api.VerifyIdentity)
+	r.POST("/user/:id/merge", api.MergeUser)
+	r.POST("/auth/identity/code", api.SendLoginCode)
+	r.POST("/auth/identity", api.IdentityLogin)
+	post := func(path string, body interface{}) (int, map[string]interface{}) {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var res map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return w.Code, res
+	}
+	createUser := func() string {
+		code, res := post("/user", map[string]interface{}{"username": testUsername(), "deviceID": (uuid.New()).String(), "country": "TUR"})
+		assert.Equal(t, http.StatusCreated, code)
+		id, _ := res["id"].(string)
+		return id
+	}
+
+	// The old account links and verifies an email
+	userID := createUser()
+	email := strings.ToLower((uuid.New()).String()[:8]) + "@example.com"
+	identity := map[string]interface{}{"kind": structs.IdentityKindEmail, "value": email}
+	code, _ := post("/user/"+userID+"/identities", identity)
+	assert.Equal(t, http.StatusCreated, code)
+	// An unverified identity cannot be used to log in
+	code, _ = post("/auth/identity/code", identity)
+	assert.Equal(t, http.StatusAccepted, code)
+	assert.Empty(t, sender["email#"+email])
+	code, _ = post("/user/"+userID+"/identities/email/"+email+"/code", nil)
+	assert.Equal(t, http.StatusAccepted, code)
+	code, _ = post("/user/"+userID+"/identities/email/"+email+"/verify", map[string]interface{}{"code": "wrong"})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	code, _ = post("/user/"+userID+"/identities/email/"+email+"/verify", map[string]interface{}{"code": sender["email#"+email]})
+	assert.Equal(t, http.StatusOK, code)
+
+	// A new device logs in to the old account with the email
+	code, _ = post("/auth/identity/code", identity)
+	assert.Equal(t, http.StatusAccepted, code)
+	login := map[string]interface{}{"kind": structs.IdentityKindEmail, "value": email, "code": sender["email#"+email]}
+	code, res := post("/auth/identity", login)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, userID, res["userID"])
+	// Codes are used once
+	code, _ = post("/auth/identity", login)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// A guest on a new device is merged into the old account
+	guestID := createUser()
+	code, _ = post("/auth/identity/code", identity)
+	assert.Equal(t, http.StatusAccepted, code)
+	login["code"] = sender["email#"+email]
+	code, res = post("/user/"+guestID+"/merge", login)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, userID, res["id"])
+	assert.NotEmpty(t, res["accessToken"])
+}
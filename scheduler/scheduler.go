@@ -0,0 +1,106 @@
+package scheduler
+
+import (
+	"log"
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/structs"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Runs the scheduler until the process exits. Every tick creates the upcoming
+// tournaments, finalizes the ones that have ended and resumes pending user
+// deletions, so missed or doubled runs are caught up on the next tick.
+func Run(db *dynamodb.DynamoDB) {
+	owner := structs.NewLeaseOwner()
+	ticker := time.NewTicker(config.SchedulerIntervalMinutes * time.Minute)
+	defer ticker.Stop()
+	for {
+		Tick(db, owner, time.Now().UTC())
+		<-ticker.C
+	}
+}
+
+// Runs the scheduled tasks once for the given time.
+func Tick(db *dynamodb.DynamoDB, owner string, now time.Time) {
+	if err := CreateUpcomingTournaments(db, now); err != nil {
+		log.Printf("Cannot create upcoming tournaments: %s", err)
+	}
+	if err := FinalizeEndedTournaments(db, owner, now); err != nil {
+		log.Printf("Cannot finalize tournaments: %s", err)
+	}
+	if err := ResumeDeletions(db, owner); err != nil {
+		log.Printf("Cannot resume deletions: %s", err)
+	}
+}
+
+// Creates today's tournament and the tournaments of the next config.SchedulerDaysAhead days.
+// Tournaments that already exist are left untouched.
+func CreateUpcomingTournaments(db *dynamodb.DynamoDB, now time.Time) error {
+	for i := 0; i <= config.SchedulerDaysAhead; i++ {
+		t := structs.Tournament{
+			ID:          now.AddDate(0, 0, i).Format(structs.TournamentIDLayout),
+			AutoRewards: config.TournamentAutoRewards,
+			Scoring:     config.TournamentScoring,
+		}
+		created, err := t.Create(db)
+		if err != nil {
+			return err
+		}
+		if created {
+			log.Printf("Inserted tournament for %s", t.ID)
+		}
+	}
+	return nil
+}
+
+// Calculates the results of every tournament of the last config.SchedulerDaysBehind
+// days that has ended but is not completed yet. Only those days are read, as the
+// tournament table keeps growing.
+func FinalizeEndedTournaments(db *dynamodb.DynamoDB, owner string, now time.Time) error {
+	tournaments, err := structs.FetchRecentTournaments(db, now, config.SchedulerDaysBehind)
+	if err != nil {
+		return err
+	}
+	for _, t := range tournaments {
+		if t.Completed || t.Cancelled {
+			continue
+		}
+		endsAt, err := t.EndsAt()
+		if err != nil || now.Before(endsAt) {
+			continue
+		}
+		err = t.Finalize(db, owner)
+		if err == structs.ErrLeaseHeld {
+			continue
+		}
+		if err != nil {
+			log.Printf("Cannot calculate results for tournament %s: %s", t.ID, err)
+			continue
+		}
+		log.Printf("Results are calculated for tournament %s", t.ID)
+	}
+	return nil
+}
+
+// Runs the user deletions that have not been completed, e.g. because the
+// process stopped while running them.
+func ResumeDeletions(db *dynamodb.DynamoDB, owner string) error {
+	deletions, err := structs.FetchPendingDeletions(db)
+	if err != nil {
+		return err
+	}
+	for _, d := range deletions {
+		err := d.Run(db, owner)
+		if err == structs.ErrLeaseHeld {
+			continue
+		}
+		if err != nil {
+			log.Printf("Cannot delete user %s: %s", d.UserID, err)
+			continue
+		}
+		log.Printf("Deleted user %s", d.UserID)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"oguzhanakan0/good-blast-api/structs"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDB() *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	host := "http://localhost:8000"
+	if os.Getenv("DYNAMODB_HOST") != "" {
+		host = os.Getenv("DYNAMODB_HOST")
+	}
+	return dynamodb.New(sess, aws.NewConfig().WithEndpoint(host))
+}
+
+func TestCreateUpcomingTournaments(t *testing.T) {
+	db := testDB()
+	now := time.Date(2190, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Running twice creates each tournament once
+	assert.Nil(t, CreateUpcomingTournaments(db, now))
+	assert.Nil(t, CreateUpcomingTournaments(db, now))
+	for i := 0; i <= config.SchedulerDaysAhead; i++ {
+		to := structs.Tournament{ID: now.AddDate(0, 0, i).Format(structs.TournamentIDLayout)}
+		assert.Nil(t, to.Fetch(db))
+		assert.Equal(t, config.TournamentScoring, to.Scoring)
+	}
+}
+
+func TestFinalizeEndedTournaments(t *testing.T) {
+	db := testDB()
+	owner := structs.NewLeaseOwner()
+	// The scheduler did not run for three days
+	days := []string{"1990-01-01", "1990-01-02", "1990-01-03"}
+	for _, id := range days {
+		to := structs.Tournament{ID: id}
+		_, err := to.Put(db)
+		assert.Nil(t, err)
+	}
+	now := time.Date(1990, 1, 4, 0, 10, 0, 0, time.UTC)
+	// The first tick catches up on every missed day, the second one changes nothing
+	Tick(db, owner, now)
+	completedAt := map[string]string{}
+	for _, id := range days {
+		to := structs.Tournament{ID: id}
+		assert.Nil(t, to.Fetch(db))
+		assert.True(t, to.Completed)
+		completedAt[id] = to.CompletedAt
+	}
+	Tick(db, owner, now.Add(time.Hour))
+	for _, id := range days {
+		to := structs.Tournament{ID: id}
+		assert.Nil(t, to.Fetch(db))
+		assert.True(t, to.Completed)
+		assert.Equal(t, completedAt[id], to.CompletedAt)
+	}
+	// Today's tournament has not ended yet
+	today := structs.Tournament{ID: "1990-01-04"}
+	_, err := today.Put(db)
+	assert.Nil(t, err)
+	Tick(db, owner, now)
+	assert.Nil(t, today.Fetch(db))
+	assert.False(t, today.Completed)
+}
@@ -0,0 +1,101 @@
+package store
+
+import (
+	"fmt"
+	"math/rand"
+	"oguzhanakan0/good-blast-api/structs"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+func RandomUsername(n int) string {
+	f := []string{"Meadow", "Aron", "Briana", "Jax", "Ayleen", "Zayn", "Vera", "Easton", "Sawyer",
+		"Wilder", "Mikayla", "Wesson", "Emmalynn", "Devin", "Adalynn", "Larry", "Marianna", "Kieran", "Malaysia",
+		"Deandre", "Remington", "Morgan", "Giavanna", "Miguel", "Juliana", "Cohen", "Rosalee", "Parker", "Mckenna", "Jeremiah"}
+	l := []string{"Prince", "Hood", "Burke", "Church", "Cortez", "Burke", "Reed", "Estrada",
+		"Rosales", "Owen", "Trejo", "Dickson", "McCarthy", "Jordan", "Walls", "Corona", "Bauer", "Singleton",
+		"Winters", "Macias", "Ho", "Lim", "Ferguson", "Ferguson", "Wang", "Blankenship", "Patel", "Howell", "Howard", "Gallegos"}
+
+	return f[rand.Intn(len(f))] + l[rand.Intn(len(l))] + "#" + strconv.Itoa(rand.Intn(100))
+}
+
+// Inserts today's and yesterday's tournaments, and users with random scores in
+// yesterday's tournament. Yesterday's results are calculated at the end.
+func Seed(db *dynamodb.DynamoDB) error {
+	// Insert today's and yesterday's tournament
+	t := structs.Tournament{
+		ID: time.Now().UTC().Format(structs.TournamentIDLayout),
+	}
+	out, err := t.Put(db)
+	t = structs.Tournament{
+		ID: time.Now().UTC().AddDate(0, 0, -1).Format(structs.TournamentIDLayout),
+	}
+	out, err = t.Put(db)
+	if err != nil {
+		return err
+	}
+	_ = out
+	fmt.Printf("[%s] Inserted tournament\n", t.ID)
+
+	// Insert users with random scores
+	countries := []string{"TR", "US"}
+	fmt.Println("Inserting users...")
+	for i := 0; i < 100; i++ {
+		if j := (i % 10); j == 0 {
+			fmt.Println(i)
+		}
+		u := structs.User{
+			ID:          (uuid.New()).String(),
+			Level:       rand.Intn(90) + 10,
+			Coins:       (rand.Intn(90) + 10) * 100,
+			Username:    RandomUsername(5),
+			Country:     countries[rand.Intn(len(countries))],
+			Tournaments: map[string]structs.UserTournamentDetails{},
+			Inventory:   map[string]int{},
+		}
+		// Usernames are unique, pick another one if it is taken
+		for {
+			err := u.Create(db)
+			if err == nil {
+				break
+			} else if err != structs.ErrUsernameTaken {
+				return err
+			}
+			u.Username = RandomUsername(5)
+		}
+		// Enter tournament
+		err = u.EnterTournament(db, t, structs.PaymentCoins)
+		if err != nil {
+			return err
+		}
+		// Level up randomly. The tournament has ended, so the scores are added to
+		// the group directly.
+		group := structs.Group{TournamentID: t.ID, GroupID: u.Tournaments[t.ID].GroupID}
+		err = group.Fetch(db)
+		if err != nil {
+			return err
+		}
+		for k := 0; k < rand.Intn(5); k++ {
+			result := structs.LevelResult{Level: u.Level, Moves: rand.Intn(30) + 1, Stars: rand.Intn(3) + 1}
+			_, err := u.LevelUp(db, t.ID, result)
+			if err != nil {
+				return err
+			}
+			err = group.UpdateScore(db, &u, structs.FlatScoring{}.Points(result, u.Streak))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// End tournament & calculate results
+	err = t.Finalize(db, structs.NewLeaseOwner())
+	if err != nil {
+		return err
+	}
+	fmt.Printf("[%s] Updated leaderboards\n", t.ID)
+	return nil
+}
@@ -0,0 +1,21 @@
+package store
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Returns a DynamoDB client for the given environment.
+func New(env config.Env) *dynamodb.DynamoDB {
+	sess := session.Must(session.NewSessionWithOptions(session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}))
+	// Set to local DynamoDB if not in release
+	if env.Release {
+		return dynamodb.New(sess)
+	}
+	return dynamodb.New(sess, aws.NewConfig().WithEndpoint(env.DynamoDBHost))
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type table struct {
+	Name      string
+	HashKey   string
+	HashType  string
+	RangeKey  string // optional
+	RangeType string
+}
+
+// Tables used by the API.
+var tables = []table{
+	{Name: "user", HashKey: "id", HashType: "S"},
+	{Name: "tournament", HashKey: "id", HashType: "S"},
+	{Name: "group", HashKey: "tournamentID", HashType: "S", RangeKey: "groupID", RangeType: "N"},
+	{Name: "ledger", HashKey: "userID", HashType: "S", RangeKey: "id", RangeType: "S"},
+	{Name: "lease", HashKey: "name", HashType: "S"},
+	{Name: "session", HashKey: "userID", HashType: "S", RangeKey: "id", RangeType: "S"},
+	{Name: "identity", HashKey: "id", HashType: "S"},
+	{Name: "verification", HashKey: "identityID", HashType: "S"},
+	{Name: "username", HashKey: "name", HashType: "S"},
+	{Name: "deletion", HashKey: "userID", HashType: "S"},
+	{Name: "friend", HashKey: "userID", HashType: "S", RangeKey: "friendID", RangeType: "S"},
+	{Name: "friendcode", HashKey: "code", HashType: "S"},
+	{Name: "team", HashKey: "id", HashType: "S"},
+}
+
+func (t table) createInput() *dynamodb.CreateTableInput {
+	input := &dynamodb.CreateTableInput{
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{
+			{
+				AttributeName: aws.String(t.HashKey),
+				AttributeType: aws.String(t.HashType),
+			},
+		},
+		KeySchema: []*dynamodb.KeySchemaElement{
+			{
+				AttributeName: aws.String(t.HashKey),
+				KeyType:       aws.String("HASH"),
+			},
+		},
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(10),
+			WriteCapacityUnits: aws.Int64(10),
+		},
+		TableName: aws.String(t.Name),
+	}
+	if t.RangeKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(t.RangeKey),
+			AttributeType: aws.String(t.RangeType),
+		})
+		input.KeySchema = append(input.KeySchema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(t.RangeKey),
+			KeyType:       aws.String("RANGE"),
+		})
+	}
+	return input
+}
+
+// Deletes and recreates all tables. Existing data is lost.
+func CreateTables(db *dynamodb.DynamoDB) error {
+	for _, t := range tables {
+		_, err := db.DeleteTable(&dynamodb.DeleteTableInput{
+			TableName: aws.String(t.Name)})
+		if err != nil {
+			fmt.Printf("Couldn't delete table %v: %v\n", t.Name, err)
+		} else {
+			fmt.Printf("Deleted table %v.\n", t.Name)
+		}
+	}
+
+	for _, t := range tables {
+		_, err := db.CreateTable(t.createInput())
+		if err != nil {
+			return fmt.Errorf("Got error calling CreateTable for %s: %s", t.Name, err)
+		}
+	}
+
+	fmt.Println("Recreated all tables.")
+	return nil
+}
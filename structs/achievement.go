@@ -0,0 +1,294 @@
+package structs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Metrics achievements are measured with. Level is the user's level; the others
+// are counters of the user's events, kept in User.Stats.
+const (
+	MetricLevel              = "level"
+	MetricFirstPlaces        = "first-places"
+	MetricTournamentsEntered = "tournaments-entered"
+	MetricRewardsClaimed     = "rewards-claimed"
+)
+
+var Metrics = []string{MetricLevel, MetricFirstPlaces, MetricTournamentsEntered, MetricRewardsClaimed}
+
+// Definition of an achievement, unlocked when the metric reaches the target.
+type Achievement struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Metric      string `json:"metric"`
+	Target      int    `json:"target"`
+	Reward      Reward `json:"reward"` // given once on unlock
+}
+
+// Progress of a user on an achievement.
+type AchievementProgress struct {
+	Achievement
+	Progress   int    `json:"progress"`             // value of the metric, at most the target
+	UnlockedAt string `json:"unlockedAt,omitempty"` // RFC3339, set when unlocked
+}
+
+var achievements = mustParseAchievements(config.DefaultAchievements)
+
+func mustParseAchievements(data []byte) []Achievement {
+	defs, err := ParseAchievements(data)
+	if err != nil {
+		panic(err)
+	}
+	return defs
+}
+
+// Parses and validates achievement definitions in JSON.
+func ParseAchievements(data []byte) ([]Achievement, error) {
+	var defs []Achievement
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("Cannot parse achievements: %w", err)
+	}
+	ids := map[string]bool{}
+	for _, a := range defs {
+		if a.ID == "" || ids[a.ID] {
+			return nil, fmt.Errorf("Achievement ID is empty or repeated: %q", a.ID)
+		}
+		ids[a.ID] = true
+		if !slices.Contains(Metrics, a.Metric) {
+			return nil, fmt.Errorf("Unknown metric of achievement %s: %s", a.ID, a.Metric)
+		}
+		if a.Target < 1 || a.Reward.Coins < 0 {
+			return nil, fmt.Errorf("Target and reward of achievement %s must be positive.", a.ID)
+		}
+		for item, quantity := range a.Reward.Items {
+			if _, ok := Items[item]; !ok || quantity < 1 {
+				return nil, fmt.Errorf("Unknown item or quantity in the reward of achievement %s: %s", a.ID, item)
+			}
+		}
+	}
+	return defs, nil
+}
+
+// Replaces the achievement definitions with the ones in the file at path. The
+// embedded definitions are kept if path is empty.
+func LoadAchievements(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	defs, err := ParseAchievements(data)
+	if err != nil {
+		return err
+	}
+	achievements = defs
+	return nil
+}
+
+// Returns the value of a metric for the user.
+func (u *User) metric(name string) int {
+	if name == MetricLevel {
+		return u.Level
+	}
+	return u.Stats[name]
+}
+
+// Returns the user's progress on every achievement.
+func (u *User) Achievements() []AchievementProgress {
+	progress := []AchievementProgress{}
+	for _, a := range achievements {
+		progress = append(progress, AchievementProgress{
+			Achievement: a,
+			Progress:    min(u.metric(a.Metric), a.Target),
+			UnlockedAt:  u.Unlocked[a.ID],
+		})
+	}
+	return progress
+}
+
+// Returns the achievements the user has completed but not unlocked yet.
+func (u *User) completedAchievements() []Achievement {
+	var completed []Achievement
+	for _, a := range achievements {
+		if u.Unlocked[a.ID] == "" && u.metric(a.Metric) >= a.Target {
+			completed = append(completed, a)
+		}
+	}
+	return completed
+}
+
+// Creates an empty map attribute on the user if it is missing.
+func (u *User) ensureMap(db *dynamodb.DynamoDB, name string) error {
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(u.ID)},
+		},
+		UpdateExpression:    aws.String("SET #map = :map"),
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(#map) OR attribute_type(#map, :null))"),
+		ExpressionAttributeNames: map[string]*string{
+			"#map": aws.String(name),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":map":  {M: map[string]*dynamodb.AttributeValue{}},
+			":null": {S: aws.String("NULL")},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
+
+// Counts the events of the given metrics, then unlocks every achievement the
+// user has completed and gives its reward. Returns the achievements unlocked.
+func (u *User) TrackAchievements(db *dynamodb.DynamoDB, now time.Time, events ...string) ([]Achievement, error) {
+	if len(events) > 0 {
+		err := u.countEvents(db, events)
+		if err != nil {
+			return nil, err
+		}
+	}
+	completed := u.completedAchievements()
+	if len(completed) == 0 {
+		return nil, nil
+	}
+	err := u.ensureMap(db, "unlocked")
+	if err != nil {
+		return nil, err
+	}
+	var unlocked []Achievement
+	for _, a := range completed {
+		ok, err := u.unlock(db, a, now)
+		if err != nil {
+			return unlocked, err
+		}
+		if ok {
+			unlocked = append(unlocked, a)
+		}
+	}
+	return unlocked, nil
+}
+
+// Adds one to the counters of the events.
+func (u *User) countEvents(db *dynamodb.DynamoDB, events []string) error {
+	err := u.ensureMap(db, "stats")
+	if err != nil {
+		return err
+	}
+	expr := ""
+	names := map[string]*string{
+		"#stats": aws.String("stats"),
+	}
+	for i, event := range events {
+		name := "#event" + strconv.Itoa(i)
+		if expr != "" {
+			expr += ", "
+		}
+		expr += "#stats." + name + " = if_not_exists(#stats." + name + ", :zero) + :one"
+		names[name] = aws.String(event)
+	}
+	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(u.ID)},
+		},
+		UpdateExpression:         aws.String("SET " + expr),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":zero": {N: aws.String("0")},
+			":one":  {N: aws.String("1")},
+		},
+		ReturnValues: aws.String(dynamodb.ReturnValueUpdatedNew),
+	})
+	if err != nil {
+		return err
+	}
+	var updated struct {
+		Stats map[string]int `json:"stats"`
+	}
+	dynamodbattribute.UnmarshalMap(out.Attributes, &updated)
+	if u.Stats == nil {
+		u.Stats = map[string]int{}
+	}
+	for event, count := range updated.Stats {
+		u.Stats[event] = count
+	}
+	return nil
+}
+
+// Marks the achievement unlocked and gives its reward in one transaction.
+// Returns false if the achievement has already been unlocked.
+func (u *User) unlock(db *dynamodb.DynamoDB, a Achievement, now time.Time) (bool, error) {
+	var entries []LedgerEntry
+	if a.Reward.Coins != 0 {
+		entries = append(entries, NewLedgerEntry(u.ID, LedgerReasonAchievement, a.Reward.Coins, ""))
+	}
+	entries = append(entries, NewItemLedgerEntries(u.ID, LedgerReasonAchievement, a.Reward.Items, "")...)
+	ledger, err := ledgerPuts(entries...)
+	if err != nil {
+		return false, err
+	}
+	unlockedAt := now.UTC().Format(time.RFC3339)
+	names := map[string]*string{
+		"#unlocked":    aws.String("unlocked"),
+		"#achievement": aws.String(a.ID),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":unlockedAt": {S: aws.String(unlockedAt)},
+		":coins":      {N: aws.String(strconv.Itoa(a.Reward.Coins))},
+	}
+	expr := "SET #unlocked.#achievement = :unlockedAt, coins = coins + :coins"
+	if len(a.Reward.Items) > 0 {
+		err = u.ensureInventory(db)
+		if err != nil {
+			return false, err
+		}
+		expr += ", " + inventoryUpdate(a.Reward.Items, names, values)
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:          aws.String(expr),
+					ConditionExpression:       aws.String("attribute_not_exists(#unlocked.#achievement)"),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if len(failedConditions(err)) > 0 {
+			return false, nil
+		}
+		return false, err
+	}
+	if u.Unlocked == nil {
+		u.Unlocked = map[string]string{}
+	}
+	u.Unlocked[a.ID] = unlockedAt
+	u.Coins += a.Reward.Coins
+	for item, quantity := range a.Reward.Items {
+		u.Inventory[item] += quantity
+	}
+	return true, nil
+}
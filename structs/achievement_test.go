@@ -0,0 +1,43 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAchievements(t *testing.T) {
+	defs, err := ParseAchievements(config.DefaultAchievements)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, defs)
+
+	_, err = ParseAchievements([]byte(`[{"id": "a", "metric": "logins", "target": 1}]`))
+	assert.NotNil(t, err)
+	_, err = ParseAchievements([]byte(`[{"id": "a", "metric": "level", "target": 0}]`))
+	assert.NotNil(t, err)
+	_, err = ParseAchievements([]byte(`[{"id": "a", "metric": "level", "target": 1, "reward": {"items": {"unicorn": 1}}}]`))
+	assert.NotNil(t, err)
+	_, err = ParseAchievements([]byte(`[{"id": "a", "metric": "level", "target": 1}, {"id": "a", "metric": "level", "target": 2}]`))
+	assert.NotNil(t, err)
+}
+
+func TestAchievements(t *testing.T) {
+	defer func(defs []Achievement) { achievements = defs }(achievements)
+	achievements = []Achievement{
+		{ID: "level-5", Metric: MetricLevel, Target: 5},
+		{ID: "enter-2", Metric: MetricTournamentsEntered, Target: 2},
+		{ID: "win", Metric: MetricFirstPlaces, Target: 1},
+	}
+	u := User{Level: 7, Stats: map[string]int{MetricTournamentsEntered: 1}, Unlocked: map[string]string{"level-5": "2000-01-01T00:00:00Z"}}
+
+	progress := u.Achievements()
+	assert.Equal(t, 5, progress[0].Progress)
+	assert.Equal(t, "2000-01-01T00:00:00Z", progress[0].UnlockedAt)
+	assert.Equal(t, 1, progress[1].Progress)
+	assert.Equal(t, 0, progress[2].Progress)
+	assert.Empty(t, u.completedAchievements())
+
+	u.Stats[MetricTournamentsEntered] = 2
+	assert.Equal(t, []Achievement{achievements[1]}, u.completedAchievements())
+}
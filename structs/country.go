@@ -0,0 +1,82 @@
+package structs
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+var ErrUnknownCountry = errors.New("Country code is not a known ISO 3166 country.")
+
+// ISO 3166-1 alpha-2 codes of the officially assigned countries.
+const countryCodes = "AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ " +
+	"BR BS BT BV BW BY BZ CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ DE DJ DK DM " +
+	"DO DZ EC EE EG EH ER ES ET FI FJ FK FM FO FR GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS " +
+	"GT GU GW GY HK HM HN HR HT HU ID IE IL IM IN IO IQ IR IS IT JE JM JO JP KE KG KH KI KM KN " +
+	"KP KR KW KY KZ LA LB LC LI LK LR LS LT LU LV LY MA MC MD ME MF MG MH MK ML MM MN MO MP MQ " +
+	"MR MS MT MU MV MW MX MY MZ NA NC NE NF NG NI NL NO NP NR NU NZ OM PA PE PF PG PH PK PL PM " +
+	"PN PR PS PT PW PY QA RE RO RS RU RW SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV " +
+	"SX SY SZ TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ UA UG UM US UY UZ VA VC VE VG VI " +
+	"VN VU WF WS YE YT ZA ZM ZW"
+
+// Codes that are commonly used instead of the ISO 3166 ones.
+var countryAliases = map[string]string{"UK": "GB"}
+
+var countries = map[string]bool{}
+
+func init() {
+	for _, code := range strings.Fields(countryCodes) {
+		countries[code] = true
+	}
+}
+
+type Country struct {
+	Code   string `json:"code"`   // ISO 3166-1 alpha-2
+	Alpha3 string `json:"alpha3"` // ISO 3166-1 alpha-3
+	Name   string `json:"name"`
+}
+
+// Returns the ISO 3166-1 alpha-2 code of a country given as an alpha-2,
+// alpha-3 or numeric code in any case. Returns ErrUnknownCountry otherwise.
+func NormalizeCountry(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if alias, ok := countryAliases[code]; ok {
+		return alias, nil
+	}
+	region, err := language.ParseRegion(code)
+	if err != nil || !countries[region.String()] {
+		return code, ErrUnknownCountry
+	}
+	return region.String(), nil
+}
+
+// Returns the country of the first language in an Accept-Language header that
+// names one explicitly, e.g. "tr-TR". Returns "" if there is none.
+func CountryFromAcceptLanguage(header string) string {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil {
+		return ""
+	}
+	for _, tag := range tags {
+		// Regions guessed from the language alone ("en" is "US") are ignored
+		if region, confidence := tag.Region(); confidence == language.Exact && countries[region.String()] {
+			return region.String()
+		}
+	}
+	return ""
+}
+
+// Returns all known countries ordered by code.
+func Countries() []Country {
+	names := display.English.Regions()
+	list := []Country{}
+	for code := range countries {
+		region := language.MustParseRegion(code)
+		list = append(list, Country{Code: code, Alpha3: region.ISO3(), Name: names.Name(region)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
@@ -0,0 +1,150 @@
+package structs
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Result of MigrateCountries.
+type CountryMigration struct {
+	Users       int      `json:"users"`       // users whose country was normalized
+	Players     int      `json:"players"`     // group records whose country was normalized
+	Tournaments int      `json:"tournaments"` // completed tournaments whose leaderboards were recalculated
+	Unknown     []string `json:"unknown"`     // IDs of users with a country that is not known, left as is
+}
+
+// Returns the normalized country and true if it differs from the stored one.
+func migratedCountry(country string) (string, bool) {
+	if country == "" {
+		return country, false
+	}
+	normalized, err := NormalizeCountry(country)
+	return normalized, err == nil && normalized != country
+}
+
+// Normalizes the countries stored in users and group records to ISO 3166-1
+// alpha-2, and recalculates the leaderboards of completed tournaments that have
+// a leaderboard for a country that is not normalized. Records that change while
+// being migrated are skipped, so the migration can safely be run again.
+func MigrateCountries(db *dynamodb.DynamoDB) (CountryMigration, error) {
+	migration := CountryMigration{Unknown: []string{}}
+
+	// Users
+	var users []User
+	err := db.ScanPages(&dynamodb.ScanInput{TableName: aws.String("user")}, func(out *dynamodb.ScanOutput, last bool) bool {
+		for _, e := range out.Items {
+			var user User
+			dynamodbattribute.UnmarshalMap(e, &user)
+			users = append(users, user)
+		}
+		return true
+	})
+	if err != nil {
+		return migration, err
+	}
+	for _, user := range users {
+		country, ok := migratedCountry(user.Country)
+		if !ok {
+			if _, err := NormalizeCountry(user.Country); user.Country != "" && err != nil {
+				migration.Unknown = append(migration.Unknown, user.ID)
+			}
+			continue
+		}
+		_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("user"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(user.ID)},
+			},
+			UpdateExpression:    aws.String("SET country = :new"),
+			ConditionExpression: aws.String("country = :old"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":new": {S: aws.String(country)},
+				":old": {S: aws.String(user.Country)},
+			},
+		})
+		if err == nil {
+			migration.Users++
+		} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+			return migration, err
+		}
+	}
+
+	// Group records, updated one by one so that concurrent score updates are kept
+	tournaments, err := FetchTournaments(db)
+	if err != nil {
+		return migration, err
+	}
+	for _, t := range tournaments {
+		groups, err := t.FetchGroups(db)
+		if err != nil {
+			return migration, err
+		}
+		for _, group := range groups {
+			for i, p := range group.Players {
+				country, ok := migratedCountry(p.Country)
+				if !ok {
+					continue
+				}
+				index := strconv.Itoa(i)
+				_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+					TableName: aws.String("group"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"tournamentID": {S: aws.String(group.TournamentID)},
+						"groupID":      {N: aws.String(strconv.Itoa(group.GroupID))},
+					},
+					UpdateExpression:    aws.String("SET players[" + index + "].country = :new"),
+					ConditionExpression: aws.String("players[" + index + "].userID = :userID"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":new":    {S: aws.String(country)},
+						":userID": {S: aws.String(p.UserID)},
+					},
+				})
+				if err == nil {
+					migration.Players++
+				} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+					return migration, err
+				}
+			}
+		}
+
+		// Leaderboards of completed tournaments are keyed by country
+		if !t.Completed {
+			continue
+		}
+		stale := false
+		for country := range t.Leaderboards {
+			if _, ok := migratedCountry(country); ok {
+				stale = true
+			}
+		}
+		if !stale {
+			continue
+		}
+		leaderboards, err := t.ComputeLeaderboards(db)
+		if err != nil {
+			return migration, err
+		}
+		av, _ := dynamodbattribute.MarshalMap(leaderboards)
+		_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("tournament"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(t.ID)},
+			},
+			UpdateExpression:    aws.String("SET leaderboards = :leaderboards"),
+			ConditionExpression: aws.String("completed = :true"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":leaderboards": {M: av},
+				":true":         {BOOL: aws.Bool(true)},
+			},
+		})
+		if err != nil {
+			return migration, err
+		}
+		migration.Tournaments++
+	}
+	return migration, nil
+}
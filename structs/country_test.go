@@ -0,0 +1,36 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeCountry(t *testing.T) {
+	for _, code := range []string{"TR", "tr", "TUR", " tur ", "792"} {
+		country, err := NormalizeCountry(code)
+		assert.Nil(t, err, code)
+		assert.Equal(t, "TR", country, code)
+	}
+	country, err := NormalizeCountry("UK")
+	assert.Nil(t, err)
+	assert.Equal(t, "GB", country)
+
+	for _, code := range []string{"", "XX", "EU", "001", "Turkey"} {
+		_, err := NormalizeCountry(code)
+		assert.Equal(t, ErrUnknownCountry, err, code)
+	}
+}
+
+func TestCountryFromAcceptLanguage(t *testing.T) {
+	assert.Equal(t, "TR", CountryFromAcceptLanguage("tr-TR,tr;q=0.9,en;q=0.8"))
+	assert.Equal(t, "GB", CountryFromAcceptLanguage("en,en-GB;q=0.9"))
+	assert.Equal(t, "", CountryFromAcceptLanguage("en,tr"))
+	assert.Equal(t, "", CountryFromAcceptLanguage(""))
+}
+
+func TestCountries(t *testing.T) {
+	list := Countries()
+	assert.Equal(t, 249, len(list))
+	assert.Equal(t, Country{Code: "AD", Alpha3: "AND", Name: "Andorra"}, list[0])
+}
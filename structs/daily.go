@@ -0,0 +1,164 @@
+package structs
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	_ "time/tzdata" // time zones of users do not depend on the host
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var ErrUnknownTimezone = errors.New("Timezone is not known.")
+
+// Daily login bonuses claimed by a user.
+type DailyBonus struct {
+	Streak    int    `json:"streak"`    // days claimed in a row
+	LastDay   string `json:"lastDay"`   // day of the last claim in the user's timezone, YYYY-MM-DD
+	ClaimedAt string `json:"claimedAt"` // RFC3339
+}
+
+// Result of claiming the daily bonus.
+type DailyBonusClaim struct {
+	Granted bool   `json:"granted"` // false if the bonus of the day had already been claimed
+	Amount  int    `json:"amount"`  // coins of the day's bonus
+	Day     int    `json:"day"`     // one-based day of config.DailyBonusCalendar
+	Streak  int    `json:"streak"`
+	NextAt  string `json:"nextAt"` // RFC3339, when the next bonus can be claimed
+}
+
+// Returns the time zone with the given IANA name. UTC is used if the name is empty.
+func LoadTimezone(name string) (*time.Location, error) {
+	if name == "Local" {
+		return nil, ErrUnknownTimezone
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrUnknownTimezone
+	}
+	return loc, nil
+}
+
+// Returns the user's time zone, or UTC if it is not set.
+func (u *User) Location() *time.Location {
+	loc, err := LoadTimezone(u.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Returns the coins of the bonus for the given streak. The calendar starts over
+// after its last day.
+func DailyBonusAmount(streak int) int {
+	return config.DailyBonusCalendar[(max(streak, 1)-1)%len(config.DailyBonusCalendar)]
+}
+
+// Returns the bonus after claiming it at the given time, and false if the bonus
+// of that day has already been claimed. The streak continues if the last claim
+// was on the previous day and starts over otherwise. Days only move forward, so
+// changing the time zone cannot give a day twice.
+func (b DailyBonus) Claim(now time.Time, loc *time.Location) (DailyBonus, bool) {
+	local := now.In(loc)
+	today := local.Format(time.DateOnly)
+	if b.LastDay >= today {
+		return b, false
+	}
+	next := DailyBonus{Streak: 1, LastDay: today, ClaimedAt: now.UTC().Format(time.RFC3339)}
+	if b.LastDay == local.AddDate(0, 0, -1).Format(time.DateOnly) {
+		next.Streak = b.Streak + 1
+	}
+	return next, true
+}
+
+// Describes the bonus as claimed at the given time.
+func (b DailyBonus) claim(granted bool, now time.Time, loc *time.Location) DailyBonusClaim {
+	local := now.In(loc)
+	tomorrow := time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, loc)
+	return DailyBonusClaim{
+		Granted: granted,
+		Amount:  DailyBonusAmount(b.Streak),
+		Day:     (max(b.Streak, 1)-1)%len(config.DailyBonusCalendar) + 1,
+		Streak:  b.Streak,
+		NextAt:  tomorrow.UTC().Format(time.RFC3339),
+	}
+}
+
+// Gives the user the bonus of the day in their time zone and records it in the
+// ledger. Claiming again on the same day grants nothing and returns the claim
+// of the day.
+func (u *User) ClaimDailyBonus(db *dynamodb.DynamoDB, now time.Time) (DailyBonusClaim, error) {
+	loc := u.Location()
+	var prev DailyBonus
+	if u.DailyBonus != nil {
+		prev = *u.DailyBonus
+	}
+	next, ok := prev.Claim(now, loc)
+	if !ok {
+		return prev.claim(false, now, loc), nil
+	}
+	amount := DailyBonusAmount(next.Streak)
+	entry := NewLedgerEntry(u.ID, LedgerReasonDailyBonus, amount, "")
+	ledger, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return DailyBonusClaim{}, errors.New("Cannot marshal the ledger entry.")
+	}
+	bonus, err := dynamodbattribute.MarshalMap(next)
+	if err != nil {
+		return DailyBonusClaim{}, errors.New("Cannot marshal the daily bonus.")
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":bonus":  {M: bonus},
+		":amount": {N: aws.String(strconv.Itoa(amount))},
+	}
+	// The bonus must not have been claimed since it was read
+	condition := "attribute_exists(id) AND attribute_not_exists(dailyBonus)"
+	if prev.LastDay != "" {
+		condition = "dailyBonus.lastDay = :lastDay"
+		values[":lastDay"] = &dynamodb.AttributeValue{S: aws.String(prev.LastDay)}
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:          aws.String("SET dailyBonus = :bonus, coins = coins + :amount"),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeValues: values,
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName: aws.String("ledger"),
+					Item:      ledger,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			// Another request has claimed the bonus in the meantime
+			if err := u.Fetch(db); err != nil {
+				return DailyBonusClaim{}, err
+			}
+			if u.DailyBonus != nil {
+				if _, ok := u.DailyBonus.Claim(now, loc); !ok {
+					return u.DailyBonus.claim(false, now, loc), nil
+				}
+			}
+			return DailyBonusClaim{}, ErrUserChanged
+		}
+		return DailyBonusClaim{}, err
+	}
+	u.DailyBonus = &next
+	u.Coins += amount
+	return next.claim(true, now, loc), nil
+}
@@ -0,0 +1,44 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyBonusClaim(t *testing.T) {
+	istanbul, err := LoadTimezone("Europe/Istanbul")
+	assert.Nil(t, err)
+
+	// 22:30 UTC is already the next day in Istanbul
+	b, ok := DailyBonus{}.Claim(time.Date(2000, 1, 1, 22, 30, 0, 0, time.UTC), istanbul)
+	assert.True(t, ok)
+	assert.Equal(t, DailyBonus{Streak: 1, LastDay: "2000-01-02", ClaimedAt: "2000-01-01T22:30:00Z"}, b)
+
+	// Once a day
+	_, ok = b.Claim(time.Date(2000, 1, 2, 12, 0, 0, 0, time.UTC), istanbul)
+	assert.False(t, ok)
+
+	// The streak continues on the next day
+	b, ok = b.Claim(time.Date(2000, 1, 3, 8, 0, 0, 0, time.UTC), istanbul)
+	assert.True(t, ok)
+	assert.Equal(t, 2, b.Streak)
+
+	// and starts over after a missed day
+	b, ok = b.Claim(time.Date(2000, 1, 5, 8, 0, 0, 0, time.UTC), istanbul)
+	assert.True(t, ok)
+	assert.Equal(t, 1, b.Streak)
+
+	// A time zone behind the last claim cannot give the day again
+	_, ok = b.Claim(time.Date(2000, 1, 5, 8, 0, 0, 0, time.UTC), time.FixedZone("", -10*60*60))
+	assert.False(t, ok)
+}
+
+func TestDailyBonusAmount(t *testing.T) {
+	n := len(config.DailyBonusCalendar)
+	assert.Equal(t, config.DailyBonusCalendar[0], DailyBonusAmount(1))
+	assert.Equal(t, config.DailyBonusCalendar[n-1], DailyBonusAmount(n))
+	assert.Equal(t, config.DailyBonusCalendar[0], DailyBonusAmount(n+1))
+}
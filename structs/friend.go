@@ -0,0 +1,378 @@
+package structs
+
+import (
+	"crypto/rand"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	FriendStatusOutgoing = "outgoing" // request sent by the user
+	FriendStatusIncoming = "incoming" // request received by the user
+	FriendStatusAccepted = "accepted"
+)
+
+var (
+	ErrFriendExists      = errors.New("Users are already friends or have a pending request.")
+	ErrFriendNotFound    = errors.New("Friend request is not found.")
+	ErrTooManyFriends    = errors.New("Friend limit is reached.")
+	ErrFriendCodeUnknown = errors.New("Friend code is not found.")
+)
+
+// Letters of friend codes, without the ones that are easily mixed up (0/O, 1/I).
+const friendCodeLetters = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// One side of a friendship. Each friendship is stored twice, once for each user,
+// so that a user's friends are listed with a single query.
+type Friendship struct {
+	UserID    string `json:"userID"`
+	FriendID  string `json:"friendID"`
+	Status    string `json:"status"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Maps a friend code to its user.
+type FriendCode struct {
+	Code   string `json:"code"`
+	UserID string `json:"userID"`
+}
+
+func newFriendCode() string {
+	b := make([]byte, config.FriendCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = friendCodeLetters[int(b[i])%len(friendCodeLetters)]
+	}
+	return string(b)
+}
+
+// Returns the user's friend code, creating one on first use.
+func (u *User) GetFriendCode(db *dynamodb.DynamoDB) (string, error) {
+	if u.FriendCode != "" {
+		return u.FriendCode, nil
+	}
+	for {
+		code := FriendCode{Code: newFriendCode(), UserID: u.ID}
+		av, err := dynamodbattribute.MarshalMap(code)
+		if err != nil {
+			return "", errors.New("Cannot marshal the friend code.")
+		}
+		_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+			TransactItems: []*dynamodb.TransactWriteItem{
+				{
+					Put: &dynamodb.Put{
+						TableName:           aws.String("friendcode"),
+						Item:                av,
+						ConditionExpression: aws.String("attribute_not_exists(code)"),
+					},
+				},
+				{
+					Update: &dynamodb.Update{
+						TableName: aws.String("user"),
+						Key: map[string]*dynamodb.AttributeValue{
+							"id": {S: aws.String(u.ID)},
+						},
+						UpdateExpression:    aws.String("SET friendCode = :code"),
+						ConditionExpression: aws.String("attribute_exists(id) AND attribute_not_exists(friendCode)"),
+						ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+							":code": {S: aws.String(code.Code)},
+						},
+					},
+				},
+			},
+		})
+		if err == nil {
+			u.FriendCode = code.Code
+			return code.Code, nil
+		}
+		failed := failedConditions(err)
+		if len(failed) == 1 && failed[0] == 0 {
+			// The code is taken, try another one
+			continue
+		}
+		if len(failed) > 0 {
+			// A code was created by another request
+			if err := u.Fetch(db); err != nil {
+				return "", err
+			}
+			return u.FriendCode, nil
+		}
+		return "", err
+	}
+}
+
+// Returns the ID of the user with the friend code.
+func FindFriendCode(db *dynamodb.DynamoDB, code string) (string, error) {
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("friendcode"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(strings.ToUpper(strings.TrimSpace(code)))},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if out.Item == nil {
+		return "", ErrFriendCodeUnknown
+	}
+	var fc FriendCode
+	err = dynamodbattribute.UnmarshalMap(out.Item, &fc)
+	return fc.UserID, err
+}
+
+// Returns the friends and pending requests of a user.
+func FetchFriends(db *dynamodb.DynamoDB, userID string) ([]Friendship, error) {
+	friends := []Friendship{}
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("friend"),
+		KeyConditionExpression: aws.String("userID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userID": {S: aws.String(userID)},
+		},
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, e := range out.Items {
+			var f Friendship
+			dynamodbattribute.UnmarshalMap(e, &f)
+			friends = append(friends, f)
+		}
+		return true
+	})
+	return friends, err
+}
+
+func friendshipPut(f Friendship, condition string, values map[string]*dynamodb.AttributeValue) (*dynamodb.TransactWriteItem, error) {
+	av, err := dynamodbattribute.MarshalMap(f)
+	if err != nil {
+		return nil, errors.New("Cannot marshal the friendship.")
+	}
+	put := &dynamodb.Put{
+		TableName:           aws.String("friend"),
+		Item:                av,
+		ConditionExpression: aws.String(condition),
+	}
+	if len(values) > 0 {
+		put.ExpressionAttributeValues = values
+	}
+	return &dynamodb.TransactWriteItem{Put: put}, nil
+}
+
+// Sends a friend request from the user to another user. If the other user has
+// already sent a request to the user, it is accepted instead.
+func SendFriendRequest(db *dynamodb.DynamoDB, userID string, friendID string) (Friendship, error) {
+	if userID == friendID {
+		return Friendship{}, errors.New("Cannot add yourself as a friend.")
+	}
+	friends, err := FetchFriends(db, userID)
+	if err != nil {
+		return Friendship{}, err
+	}
+	for _, f := range friends {
+		if f.FriendID != friendID {
+			continue
+		}
+		if f.Status == FriendStatusIncoming {
+			return AcceptFriendRequest(db, userID, friendID)
+		}
+		return f, ErrFriendExists
+	}
+	if len(friends) >= config.FriendsMaxCount {
+		return Friendship{}, ErrTooManyFriends
+	}
+	// The request counts towards the limit of the friend as well
+	theirs, err := FetchFriends(db, friendID)
+	if err != nil {
+		return Friendship{}, err
+	}
+	if len(theirs) >= config.FriendsMaxCount {
+		return Friendship{}, ErrTooManyFriends
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	out := Friendship{UserID: userID, FriendID: friendID, Status: FriendStatusOutgoing, CreatedAt: now}
+	in := Friendship{UserID: friendID, FriendID: userID, Status: FriendStatusIncoming, CreatedAt: now}
+	items := []*dynamodb.TransactWriteItem{}
+	for _, f := range []Friendship{out, in} {
+		item, err := friendshipPut(f, "attribute_not_exists(userID)", nil)
+		if err != nil {
+			return out, err
+		}
+		items = append(items, item)
+	}
+	// The friend must exist
+	items = append(items, &dynamodb.TransactWriteItem{
+		ConditionCheck: &dynamodb.ConditionCheck{
+			TableName: aws.String("user"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(friendID)},
+			},
+			ConditionExpression: aws.String("attribute_exists(id)"),
+		},
+	})
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		for _, i := range failedConditions(err) {
+			if i == 2 {
+				return out, errors.New("User does not exist.")
+			}
+			return out, ErrFriendExists
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// Returns the number of accepted friends of a user.
+func countFriends(db *dynamodb.DynamoDB, userID string) (int, error) {
+	friends, err := FetchFriends(db, userID)
+	count := 0
+	for _, f := range friends {
+		if f.Status == FriendStatusAccepted {
+			count++
+		}
+	}
+	return count, err
+}
+
+// Accepts the request the user received from the friend. Fails if either user
+// already has config.FriendsMaxCount friends.
+func AcceptFriendRequest(db *dynamodb.DynamoDB, userID string, friendID string) (Friendship, error) {
+	for _, id := range []string{userID, friendID} {
+		count, err := countFriends(db, id)
+		if err != nil {
+			return Friendship{}, err
+		}
+		if count >= config.FriendsMaxCount {
+			return Friendship{}, ErrTooManyFriends
+		}
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	mine := Friendship{UserID: userID, FriendID: friendID, Status: FriendStatusAccepted, CreatedAt: now}
+	theirs := Friendship{UserID: friendID, FriendID: userID, Status: FriendStatusAccepted, CreatedAt: now}
+	items := []*dynamodb.TransactWriteItem{}
+	for _, f := range []struct {
+		friendship Friendship
+		status     string
+	}{{mine, FriendStatusIncoming}, {theirs, FriendStatusOutgoing}} {
+		item, err := friendshipPut(f.friendship, "#status = :status", map[string]*dynamodb.AttributeValue{
+			":status": {S: aws.String(f.status)},
+		})
+		if err != nil {
+			return mine, err
+		}
+		item.Put.ExpressionAttributeNames = map[string]*string{"#status": aws.String("status")}
+		items = append(items, item)
+	}
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return mine, ErrFriendNotFound
+		}
+		return mine, err
+	}
+	return mine, nil
+}
+
+// Removes a friend, or declines or cancels a pending request.
+func RemoveFriend(db *dynamodb.DynamoDB, userID string, friendID string) error {
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					TableName: aws.String("friend"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"userID":   {S: aws.String(userID)},
+						"friendID": {S: aws.String(friendID)},
+					},
+					ConditionExpression: aws.String("attribute_exists(userID)"),
+				},
+			},
+			{
+				Delete: &dynamodb.Delete{
+					TableName: aws.String("friend"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"userID":   {S: aws.String(friendID)},
+						"friendID": {S: aws.String(userID)},
+					},
+				},
+			},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+		return ErrFriendNotFound
+	}
+	return err
+}
+
+// A player on a friends leaderboard.
+type FriendScore struct {
+	Rank     int    `json:"rank"` // one-based
+	UserID   string `json:"userID"`
+	Username string `json:"username"`
+	Score    int    `json:"score"`
+}
+
+// Sorts the scores from highest to lowest and sets their ranks. Players with
+// the same score share a rank.
+func RankFriends(scores []FriendScore) []FriendScore {
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+	for i := range scores {
+		scores[i].Rank = i + 1
+		if i > 0 && scores[i].Score == scores[i-1].Score {
+			scores[i].Rank = scores[i-1].Rank
+		}
+	}
+	return scores
+}
+
+// Ranks the tournament scores of the user and their friends who entered the
+// tournament. Scores are read from the group each player is in.
+func FriendsLeaderboard(db *dynamodb.DynamoDB, user User, tournamentID string) ([]FriendScore, error) {
+	friends, err := FetchFriends(db, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	players := []User{user}
+	for _, f := range friends {
+		if f.Status != FriendStatusAccepted {
+			continue
+		}
+		friend := User{ID: f.FriendID}
+		if err := friend.Fetch(db); err != nil {
+			continue
+		}
+		players = append(players, friend)
+	}
+
+	groups := map[int]*Group{}
+	scores := []FriendScore{}
+	for _, p := range players {
+		details, ok := p.Tournaments[tournamentID]
+		if !ok {
+			continue
+		}
+		group, ok := groups[details.GroupID]
+		if !ok {
+			group = &Group{TournamentID: tournamentID, GroupID: details.GroupID}
+			if err := group.Fetch(db); err != nil {
+				return nil, err
+			}
+			groups[details.GroupID] = group
+		}
+		for _, record := range group.Players {
+			if record.UserID == p.ID {
+				scores = append(scores, FriendScore{UserID: p.ID, Username: p.Username, Score: record.Score})
+				break
+			}
+		}
+	}
+	return RankFriends(scores), nil
+}
@@ -0,0 +1,31 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRankFriends(t *testing.T) {
+	scores := RankFriends([]FriendScore{
+		{UserID: "a", Score: 10},
+		{UserID: "b", Score: 30},
+		{UserID: "c", Score: 10},
+		{UserID: "d", Score: 5},
+	})
+	assert.Equal(t, []FriendScore{
+		{Rank: 1, UserID: "b", Score: 30},
+		{Rank: 2, UserID: "a", Score: 10},
+		{Rank: 2, UserID: "c", Score: 10},
+		{Rank: 4, UserID: "d", Score: 5},
+	}, scores)
+}
+
+func TestNewFriendCode(t *testing.T) {
+	code := newFriendCode()
+	assert.Len(t, code, config.FriendCodeLength)
+	for _, r := range code {
+		assert.Contains(t, friendCodeLetters, string(r))
+	}
+}
@@ -2,16 +2,29 @@ package structs
 
 import (
 	"errors"
+	"log"
+	"oguzhanakan0/good-blast-api/config"
 	"strconv"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
+// Number of times a record is tried to be seated when other records are seated
+// at the same time.
+const seatAttempts = 5
+
+var (
+	ErrGroupFull       = errors.New("Group is full.")
+	ErrSeatUnavailable = errors.New("Cannot find a seat in the tournament, please try again.")
+)
+
 type Group struct {
 	TournamentID string                 `json:"tournamentID"`
 	GroupID      int                    `json:"groupID"`
+	League       string                 `json:"league,omitempty"` // league of the players, empty in team tournaments
 	Players      []UserTournamentRecord `json:"players"`
 }
 
@@ -23,6 +36,9 @@ func (g *Group) Fetch(db *dynamodb.DynamoDB) error {
 			"groupID":      {N: aws.String(strconv.Itoa(g.GroupID))},
 		},
 	})
+	if err != nil {
+		return err
+	}
 
 	if out.Item == nil {
 		return errors.New("Not found")
@@ -44,55 +60,169 @@ func (g *Group) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error) {
 	return out, err
 }
 
-func (g *Group) AddUser(db *dynamodb.DynamoDB, u *User) error {
-	ur := UserTournamentRecord{UserID: u.ID, Score: 0, Country: u.Country}
-	if g.Players == nil {
-		g.Players = []UserTournamentRecord{ur}
-	} else {
-		g.Players = append(g.Players, ur)
+// Inserts the group unless a group with the same ID already exists in the
+// tournament. Returns true if the group is created.
+func (g *Group) Create(db *dynamodb.DynamoDB) (bool, error) {
+	av, err := dynamodbattribute.MarshalMap(g)
+	if err != nil {
+		return false, errors.New("Cannot marshal group.")
 	}
-	av, _ := dynamodbattribute.MarshalList(g.Players)
-	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
-		TableName: aws.String("group"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"tournamentID": {S: aws.String(g.TournamentID)},
-			"groupID":      {N: aws.String(strconv.Itoa(g.GroupID))},
-		},
-		UpdateExpression: aws.String("SET players = :players"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":players": {L: av},
-		},
+	_, err = db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("group"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(groupID)"),
 	})
 	if err != nil {
-		return errors.New("Cannot add user to the group.")
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, err
 	}
-	_ = out
-	return nil
+	return true, nil
 }
 
-func (g *Group) UpdateScore(db *dynamodb.DynamoDB, u *User) error {
-	players := []UserTournamentRecord{}
-	for _, ur := range g.Players {
-		if ur.UserID == u.ID {
-			ur.Score++
-		}
-		players = append(players, ur)
+func (g *Group) AddUser(db *dynamodb.DynamoDB, u *User) error {
+	return g.AddRecord(db, UserTournamentRecord{UserID: u.ID, Score: 0, Country: u.Country}, config.GroupMaxLength)
+}
+
+// Appends a record to the group unless the group already has more than maxLength
+// records. In team tournaments the records are teams.
+func (g *Group) AddRecord(db *dynamodb.DynamoDB, ur UserTournamentRecord, maxLength int) error {
+	av, err := dynamodbattribute.MarshalMap(ur)
+	if err != nil {
+		return errors.New("Cannot marshal the record.")
 	}
-	av, _ := dynamodbattribute.MarshalList(players)
 	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
 		TableName: aws.String("group"),
 		Key: map[string]*dynamodb.AttributeValue{
 			"tournamentID": {S: aws.String(g.TournamentID)},
 			"groupID":      {N: aws.String(strconv.Itoa(g.GroupID))},
 		},
-		UpdateExpression: aws.String("SET players = :players"),
+		UpdateExpression:    aws.String("SET players = list_append(players, :record)"),
+		ConditionExpression: aws.String("size(players) <= :max"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":players": {L: av},
+			":record": {L: []*dynamodb.AttributeValue{{M: av}}},
+			":max":    {N: aws.String(strconv.Itoa(maxLength))},
 		},
+		ReturnValues: aws.String("ALL_NEW"),
 	})
 	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrGroupFull
+		}
 		return errors.New("Cannot add user to the group.")
 	}
-	_ = out
-	return nil
+	return dynamodbattribute.UnmarshalMap(out.Attributes, g)
+}
+
+// Removes the record with the given ID, a user or a team, from the group.
+func (g *Group) RemoveRecord(db *dynamodb.DynamoDB, id string) error {
+	for i, ur := range g.Players {
+		if ur.UserID != id {
+			continue
+		}
+		path := "players[" + strconv.Itoa(i) + "]"
+		_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("group"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"tournamentID": {S: aws.String(g.TournamentID)},
+				"groupID":      {N: aws.String(strconv.Itoa(g.GroupID))},
+			},
+			UpdateExpression:    aws.String("REMOVE " + path),
+			ConditionExpression: aws.String(path + ".userID = :userID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":userID": {S: aws.String(id)},
+			},
+		})
+		if err != nil {
+			return errors.New("Cannot remove the user from the group.")
+		}
+		g.Players = append(g.Players[:i], g.Players[i+1:]...)
+		return nil
+	}
+	return errors.New("User is not in the group.")
+}
+
+// Adds points to the user's score in the group. Only the user's record is updated,
+// so concurrent updates of other players are not overwritten.
+func (g *Group) UpdateScore(db *dynamodb.DynamoDB, u *User, points int) error {
+	return g.UpdateRecordScore(db, u.ID, points)
+}
+
+// Adds points to the score of the record with the given ID, a user or a team.
+func (g *Group) UpdateRecordScore(db *dynamodb.DynamoDB, id string, points int) error {
+	for i, ur := range g.Players {
+		if ur.UserID != id {
+			continue
+		}
+		path := "players[" + strconv.Itoa(i) + "]"
+		out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("group"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"tournamentID": {S: aws.String(g.TournamentID)},
+				"groupID":      {N: aws.String(strconv.Itoa(g.GroupID))},
+			},
+			UpdateExpression:    aws.String("SET " + path + ".score = " + path + ".score + :points"),
+			ConditionExpression: aws.String(path + ".userID = :userID"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":points": {N: aws.String(strconv.Itoa(points))},
+				":userID": {S: aws.String(id)},
+			},
+		})
+		if err != nil {
+			return errors.New("Cannot update the score of the user.")
+		}
+		_ = out
+		g.Players[i].Score += points
+		return nil
+	}
+	return errors.New("User is not in the group.")
+}
+
+// Seats the record in the last group of the league in the tournament, or in a
+// new group if the last one has more than maxLength records. Records are seated
+// regardless of league if the league is empty. Concurrent seats are retried, so
+// that a group is neither overfilled nor created twice.
+func (t *Tournament) Seat(db *dynamodb.DynamoDB, record UserTournamentRecord, league string, maxLength int) (Group, error) {
+	for attempt := 0; attempt < seatAttempts; attempt++ {
+		last, err := t.FetchLastGroup(db)
+		if err != nil {
+			return last, err
+		}
+		group := last
+		if league != "" {
+			group, err = t.FetchLastLeagueGroup(db, league)
+			if err != nil {
+				return group, err
+			}
+		}
+		// If there is an empty seat, put the record in that group
+		if group.GroupID != 0 {
+			err = group.AddRecord(db, record, maxLength)
+			if err != ErrGroupFull {
+				return group, err
+			}
+		}
+		// Otherwise create a new group and put the record in
+		group = Group{
+			TournamentID: t.ID,
+			GroupID:      last.GroupID + 1,
+			League:       league,
+			Players:      []UserTournamentRecord{record},
+		}
+		created, err := group.Create(db)
+		if err != nil {
+			return group, err
+		}
+		if created {
+			if league != "" {
+				err = t.setLastLeagueGroup(db, league, group.GroupID)
+				if err != nil {
+					log.Printf("Cannot set the last %s group of tournament %s: %s", league, t.ID, err)
+				}
+			}
+			return group, nil
+		}
+	}
+	return Group{}, ErrSeatUnavailable
 }
@@ -0,0 +1,135 @@
+package structs
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Final standing of a player in a tournament, stored on the user at finalization.
+type TournamentResult struct {
+	GroupRank   int `json:"groupRank"`   // one-based
+	Score       int `json:"score"`       // final score in the group
+	CountryRank int `json:"countryRank"` // one-based, among all players of the same country
+}
+
+// A tournament the user has played, as listed in their history.
+type TournamentHistoryEntry struct {
+	TournamentID  string         `json:"tournamentID"`
+	GroupID       int            `json:"groupID"`
+	League        string         `json:"league,omitempty"`
+	GroupRank     int            `json:"groupRank,omitempty"`
+	Score         int            `json:"score"`
+	CountryRank   int            `json:"countryRank,omitempty"`
+	Reward        int            `json:"reward"` // coins earned
+	RewardItems   map[string]int `json:"rewardItems,omitempty"`
+	RewardClaimed bool           `json:"rewardClaimed"`
+	Refunded      bool           `json:"refunded"` // true if the tournament was cancelled and the entry cost given back
+}
+
+// Returns the results of every player in the groups. Ranks follow the order of
+// the leaderboards, so the country rank of a player is their position on the
+// country leaderboard.
+func TournamentResults(groups []Group) map[string]TournamentResult {
+	results := map[string]TournamentResult{}
+	var players []UserTournamentRecord
+	for _, group := range groups {
+		for rank, p := range group.Ranking() {
+			results[p.UserID] = TournamentResult{GroupRank: rank + 1, Score: p.Score}
+		}
+		players = append(players, group.Players...)
+	}
+	sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+	countryRanks := map[string]int{}
+	for _, p := range players {
+		countryRanks[p.Country]++
+		result := results[p.UserID]
+		result.CountryRank = countryRanks[p.Country]
+		results[p.UserID] = result
+	}
+	return results
+}
+
+// Stores the result of every player on their user record, so that the history
+// of a user does not need the groups of each tournament. Results are replaced
+// when the tournament is recalculated.
+func (t *Tournament) storeResults(db *dynamodb.DynamoDB, groups []Group) error {
+	if t.Team {
+		return nil
+	}
+	for userID, result := range TournamentResults(groups) {
+		av, err := dynamodbattribute.MarshalMap(result)
+		if err != nil {
+			return err
+		}
+		_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("user"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"id": {S: aws.String(userID)},
+			},
+			UpdateExpression:    aws.String("SET tournaments.#tid.#result = :result"),
+			ConditionExpression: aws.String("attribute_exists(tournaments.#tid)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#tid":    aws.String(t.ID),
+				"#result": aws.String("result"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":result": {M: av},
+			},
+		})
+		// The user has been deleted
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns a page of the tournaments the user has played that are finalized or
+// cancelled, latest first. The page starts after the tournament with the ID
+// before, or at the latest one if before is empty. The returned cursor is the
+// before of the next page, empty if there are no more tournaments.
+func (u *User) TournamentHistory(before string, limit int) ([]TournamentHistoryEntry, string) {
+	var ids []string
+	for id, details := range u.Tournaments {
+		if (details.Result != nil || details.Refunded) && (before == "" || id < before) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	next := ""
+	if len(ids) > limit {
+		ids = ids[:limit]
+		next = ids[limit-1]
+	}
+	entries := []TournamentHistoryEntry{}
+	for _, id := range ids {
+		details := u.Tournaments[id]
+		entry := TournamentHistoryEntry{
+			TournamentID:  id,
+			GroupID:       details.GroupID,
+			League:        details.League,
+			RewardClaimed: details.RewardClaimed,
+			Refunded:      details.Refunded,
+		}
+		if details.Result != nil {
+			entry.GroupRank = details.Result.GroupRank
+			entry.Score = details.Result.Score
+			entry.CountryRank = details.Result.CountryRank
+		}
+		if details.RewardFixed {
+			entry.Reward, entry.RewardItems = details.Reward, details.RewardItems
+		} else if entry.GroupRank > 0 && !details.Refunded {
+			reward := RankReward(entry.GroupRank - 1)
+			entry.Reward, entry.RewardItems = reward.Coins, reward.Items
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next
+}
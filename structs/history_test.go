@@ -0,0 +1,46 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTournamentResults(t *testing.T) {
+	results := TournamentResults([]Group{
+		{GroupID: 1, Players: []UserTournamentRecord{
+			{UserID: "a", Score: 5, Country: "TR"},
+			{UserID: "b", Score: 9, Country: "US"},
+		}},
+		{GroupID: 2, Players: []UserTournamentRecord{
+			{UserID: "c", Score: 7, Country: "TR"},
+		}},
+	})
+	assert.Equal(t, map[string]TournamentResult{
+		"a": {GroupRank: 2, Score: 5, CountryRank: 2},
+		"b": {GroupRank: 1, Score: 9, CountryRank: 1},
+		"c": {GroupRank: 1, Score: 7, CountryRank: 1},
+	}, results)
+}
+
+func TestTournamentHistory(t *testing.T) {
+	u := User{Tournaments: map[string]UserTournamentDetails{
+		"2000-01-01": {GroupID: 1, Result: &TournamentResult{GroupRank: 1, Score: 10, CountryRank: 3}, RewardClaimed: true},
+		"2000-01-02": {GroupID: 2, Refunded: true},
+		"2000-01-03": {GroupID: 3, Result: &TournamentResult{GroupRank: 2}, RewardFixed: true, Reward: 40},
+		"2000-01-04": {GroupID: 4}, // not finalized yet
+	}}
+	entries, next := u.TournamentHistory("", 2)
+	assert.Equal(t, "2000-01-02", next)
+	assert.Equal(t, []TournamentHistoryEntry{
+		{TournamentID: "2000-01-03", GroupID: 3, GroupRank: 2, Reward: 40},
+		{TournamentID: "2000-01-02", GroupID: 2, Refunded: true},
+	}, entries)
+
+	entries, next = u.TournamentHistory(next, 2)
+	assert.Equal(t, "", next)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, RankReward(0).Coins, entries[0].Reward)
+	assert.Equal(t, 3, entries[0].CountryRank)
+	assert.True(t, entries[0].RewardClaimed)
+}
@@ -0,0 +1,442 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	IdentityKindDevice   = "device"
+	IdentityKindEmail    = "email"
+	IdentityKindPlatform = "platform" // e.g. Game Center or Google Play Games account ID
+)
+
+var IdentityKinds = []string{IdentityKindDevice, IdentityKindEmail, IdentityKindPlatform}
+
+var (
+	ErrIdentityTaken     = errors.New("Identity is already linked to a user.")
+	ErrIdentityNotLinked = errors.New("Identity is not linked to the user.")
+	ErrLastIdentity      = errors.New("Cannot unlink the last identity of a user.")
+	ErrUserChanged       = errors.New("User has changed, try again.")
+	ErrMergeTooLarge     = errors.New("Account has too many identities or items to merge.")
+)
+
+// Most items a DynamoDB transaction can write.
+const transactMaxItems = 100
+
+// A way of logging in as a user, e.g. a device ID. Identities are keyed by
+// kind and value so that each one belongs to a single user.
+type Identity struct {
+	ID        string `json:"id"` // format: kind#value
+	Kind      string `json:"kind"`
+	Value     string `json:"value"`
+	UserID    string `json:"userID"`
+	CreatedAt string `json:"createdAt"`
+	Verified  bool   `json:"verified"` // true once the user has proven to own it, devices are verified by logging in
+}
+
+// Returns a new identity. Device identities are verified, as they are created
+// by logging in from the device.
+func NewIdentity(kind string, value string, userID string) Identity {
+	return Identity{
+		ID:        kind + "#" + value,
+		Kind:      kind,
+		Value:     value,
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		Verified:  kind == IdentityKindDevice,
+	}
+}
+
+// Validates and normalizes an identity given by a client.
+func ParseIdentity(kind string, value string) (Identity, error) {
+	if !slices.Contains(IdentityKinds, kind) {
+		return Identity{}, fmt.Errorf("Unknown identity kind: %s", kind)
+	}
+	value = strings.TrimSpace(value)
+	if kind == IdentityKindEmail {
+		value = strings.ToLower(value)
+		if at := strings.Index(value, "@"); at < 1 || at == len(value)-1 {
+			return Identity{}, errors.New("Email is not valid.")
+		}
+	}
+	if value == "" {
+		return Identity{}, errors.New("Identity value is required.")
+	}
+	return NewIdentity(kind, value, ""), nil
+}
+
+func (i *Identity) Fetch(db *dynamodb.DynamoDB) error {
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("identity"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(i.ID)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if out.Item == nil {
+		return errors.New("Could not find identity.")
+	}
+	return dynamodbattribute.UnmarshalMap(out.Item, i)
+}
+
+// Stores the identity. Returns ErrIdentityTaken if it already exists.
+func (i *Identity) Create(db *dynamodb.DynamoDB) error {
+	av, err := dynamodbattribute.MarshalMap(i)
+	if err != nil {
+		return errors.New("Cannot marshal the identity.")
+	}
+	_, err = db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("identity"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrIdentityTaken
+		}
+		return err
+	}
+	return nil
+}
+
+// Marks the identity as verified if it is still linked to the user.
+func (i *Identity) Verify(db *dynamodb.DynamoDB, userID string) error {
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("identity"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(i.ID)},
+		},
+		UpdateExpression:    aws.String("SET verified = :true"),
+		ConditionExpression: aws.String("userID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":true":   {BOOL: aws.Bool(true)},
+			":userID": {S: aws.String(userID)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrIdentityNotLinked
+		}
+		return err
+	}
+	i.Verified = true
+	return nil
+}
+
+// Links the identity to the user. The identity is unverified until the user
+// proves to own it. Returns ErrIdentityTaken if it is already linked to a user.
+func (u *User) LinkIdentity(db *dynamodb.DynamoDB, identity Identity) error {
+	identity.UserID = u.ID
+	identity.Verified = false
+	av, err := dynamodbattribute.MarshalMap(identity)
+	if err != nil {
+		return errors.New("Cannot marshal the identity.")
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String("identity"),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:    aws.String("SET identities = list_append(if_not_exists(identities, :empty), :identity)"),
+					ConditionExpression: aws.String("attribute_exists(id) AND attribute_not_exists(mergedInto)"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":empty":    {L: []*dynamodb.AttributeValue{}},
+						":identity": {L: []*dynamodb.AttributeValue{{S: aws.String(identity.ID)}}},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return ErrIdentityTaken
+		}
+		return err
+	}
+	u.Identities = append(u.Identities, identity.ID)
+	return nil
+}
+
+// Unlinks the identity from the user. The last identity cannot be unlinked, as
+// the user could not log in anymore.
+func (u *User) UnlinkIdentity(db *dynamodb.DynamoDB, identity Identity) error {
+	index := slices.Index(u.Identities, identity.ID)
+	if index < 0 {
+		return ErrIdentityNotLinked
+	}
+	if len(u.Identities) == 1 {
+		return ErrLastIdentity
+	}
+	path := "identities[" + strconv.Itoa(index) + "]"
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					TableName: aws.String("identity"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(identity.ID)},
+					},
+					ConditionExpression: aws.String("userID = :userID"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":userID": {S: aws.String(u.ID)},
+					},
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:    aws.String("REMOVE " + path),
+					ConditionExpression: aws.String(path + " = :identity AND size(identities) > :one"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":identity": {S: aws.String(identity.ID)},
+						":one":      {N: aws.String("1")},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return ErrUserChanged
+		}
+		return err
+	}
+	u.Identities = slices.Delete(u.Identities, index, index+1)
+	return nil
+}
+
+// Returns the target user as it is after merging the guest into it: coins and
+// items are added up, and the higher level is kept.
+func MergedUser(target User, guest User) User {
+	merged := target
+	merged.Coins += guest.Coins
+	merged.Level = max(target.Level, guest.Level)
+	merged.Inventory = map[string]int{}
+	for item, quantity := range target.Inventory {
+		merged.Inventory[item] += quantity
+	}
+	for item, quantity := range guest.Inventory {
+		merged.Inventory[item] += quantity
+	}
+	merged.Identities = append(slices.Clone(target.Identities), guest.Identities...)
+	return merged
+}
+
+// Merges the guest account into the user. The guest's coins, items and
+// identities move to the user and the user keeps the higher level. Tournament
+// entries stay with the guest account, which is left empty and marked as
+// merged. The guest's username and friend code are released, and it leaves its
+// team and friends. Returns ErrUserChanged if either user changed since it was
+// fetched.
+func (u *User) Merge(db *dynamodb.DynamoDB, guest *User) error {
+	if guest.ID == u.ID {
+		return errors.New("Cannot merge a user into itself.")
+	}
+	if guest.MergedInto != "" || u.MergedInto != "" {
+		return errors.New("User is already merged into another user.")
+	}
+	merged := MergedUser(*u, *guest)
+
+	// Target: add up the balances and take over the identities
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{
+		":coins":       {N: aws.String(strconv.Itoa(guest.Coins))},
+		":level":       {N: aws.String(strconv.Itoa(merged.Level))},
+		":targetLevel": {N: aws.String(strconv.Itoa(u.Level))},
+		":empty":       {L: []*dynamodb.AttributeValue{}},
+		":identities":  {L: []*dynamodb.AttributeValue{}},
+	}
+	for _, id := range guest.Identities {
+		values[":identities"].L = append(values[":identities"].L, &dynamodb.AttributeValue{S: aws.String(id)})
+	}
+	expr := "SET coins = coins + :coins, gameLevel = :level, identities = list_append(if_not_exists(identities, :empty), :identities)"
+	if len(guest.Inventory) > 0 {
+		if err := u.ensureInventory(db); err != nil {
+			return err
+		}
+		expr += ", " + inventoryUpdate(guest.Inventory, names, values)
+	}
+	target := &dynamodb.Update{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(u.ID)},
+		},
+		UpdateExpression:          aws.String(expr),
+		ConditionExpression:       aws.String("attribute_exists(id) AND gameLevel = :targetLevel AND attribute_not_exists(mergedInto)"),
+		ExpressionAttributeValues: values,
+	}
+	if len(names) > 0 {
+		target.ExpressionAttributeNames = names
+	}
+
+	// Guest: empty the account, conditional on the balances that were merged
+	guestValues := map[string]*dynamodb.AttributeValue{
+		":zero":       {N: aws.String("0")},
+		":inventory":  {M: map[string]*dynamodb.AttributeValue{}},
+		":empty":      {L: []*dynamodb.AttributeValue{}},
+		":mergedInto": {S: aws.String(u.ID)},
+		":coins":      {N: aws.String(strconv.Itoa(guest.Coins))},
+	}
+	guestCondition := "coins = :coins AND attribute_not_exists(mergedInto)"
+	if len(guest.Inventory) > 0 {
+		inventory, err := dynamodbattribute.Marshal(guest.Inventory)
+		if err != nil {
+			return errors.New("Cannot marshal the inventory.")
+		}
+		guestValues[":guestInventory"] = inventory
+		guestCondition += " AND inventory = :guestInventory"
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{Update: target},
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String("user"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(guest.ID)},
+				},
+				UpdateExpression:          aws.String("SET coins = :zero, inventory = :inventory, identities = :empty, mergedInto = :mergedInto REMOVE friendCode"),
+				ConditionExpression:       aws.String(guestCondition),
+				ExpressionAttributeValues: guestValues,
+			},
+		},
+	}
+
+	// Identities: point them to the user
+	for _, id := range guest.Identities {
+		items = append(items, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName: aws.String("identity"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(id)},
+				},
+				UpdateExpression:    aws.String("SET userID = :userID"),
+				ConditionExpression: aws.String("userID = :guestID"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":userID":  {S: aws.String(u.ID)},
+					":guestID": {S: aws.String(guest.ID)},
+				},
+			},
+		})
+	}
+
+	// Username and friend code: release them, unless they are taken by another user
+	if guest.Username != "" {
+		items = append(items, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String("username"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"name": {S: aws.String(usernameKey(guest.Username))},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(#name) OR userID = :userID"),
+				ExpressionAttributeNames: map[string]*string{
+					"#name": aws.String("name"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":userID": {S: aws.String(guest.ID)},
+				},
+			},
+		})
+	}
+	if guest.FriendCode != "" {
+		items = append(items, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String("friendcode"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"code": {S: aws.String(guest.FriendCode)},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(code) OR userID = :userID"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":userID": {S: aws.String(guest.ID)},
+				},
+			},
+		})
+	}
+
+	// Ledger: record the coins and items moving between the accounts
+	var entries []LedgerEntry
+	if guest.Coins != 0 {
+		entries = append(entries,
+			NewLedgerEntry(guest.ID, LedgerReasonAccountMerge, -guest.Coins, ""),
+			NewLedgerEntry(u.ID, LedgerReasonAccountMerge, guest.Coins, ""),
+		)
+	}
+	removed := map[string]int{}
+	for item, quantity := range guest.Inventory {
+		removed[item] = -quantity
+	}
+	entries = append(entries, NewItemLedgerEntries(guest.ID, LedgerReasonAccountMerge, removed, "")...)
+	entries = append(entries, NewItemLedgerEntries(u.ID, LedgerReasonAccountMerge, guest.Inventory, "")...)
+	ledger, err := ledgerPuts(entries...)
+	if err != nil {
+		return err
+	}
+	items = append(items, ledger...)
+	if len(items) > transactMaxItems {
+		return ErrMergeTooLarge
+	}
+
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return ErrUserChanged
+		}
+		return err
+	}
+	u.Coins, u.Level, u.Inventory, u.Identities = merged.Coins, merged.Level, merged.Inventory, merged.Identities
+	guest.Coins, guest.Inventory, guest.Identities, guest.MergedInto, guest.FriendCode = 0, map[string]int{}, []string{}, u.ID, ""
+	// The merge is committed, so a failure is only logged
+	if err := guest.leaveMerged(db); err != nil {
+		log.Printf("Cannot release the team and friends of merged user %s: %s", guest.ID, err)
+	}
+	return nil
+}
+
+// Takes the merged guest out of its team and removes its friendships and
+// pending requests.
+func (u *User) leaveMerged(db *dynamodb.DynamoDB) error {
+	if u.TeamID != "" {
+		team := Team{ID: u.TeamID}
+		if err := team.Fetch(db); err == nil {
+			if err := team.Leave(db, u.ID); err != nil && err != ErrNotTeamMember {
+				return err
+			}
+		}
+		u.TeamID = ""
+	}
+	friends, err := FetchFriends(db, u.ID)
+	if err != nil {
+		return err
+	}
+	for _, f := range friends {
+		if err := RemoveFriend(db, u.ID, f.FriendID); err != nil && err != ErrFriendNotFound {
+			return err
+		}
+	}
+	return nil
+}
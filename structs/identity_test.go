@@ -0,0 +1,43 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIdentity(t *testing.T) {
+	identity, err := ParseIdentity(IdentityKindEmail, " Player@Example.com ")
+	assert.Nil(t, err)
+	assert.Equal(t, "email#player@example.com", identity.ID)
+
+	identity, err = ParseIdentity(IdentityKindPlatform, "G:1234")
+	assert.Nil(t, err)
+	assert.Equal(t, "platform#G:1234", identity.ID)
+
+	assert.False(t, identity.Verified)
+	identity, err = ParseIdentity(IdentityKindDevice, "abc")
+	assert.Nil(t, err)
+	assert.True(t, identity.Verified)
+
+	_, err = ParseIdentity(IdentityKindEmail, "player")
+	assert.NotNil(t, err)
+	_, err = ParseIdentity(IdentityKindDevice, " ")
+	assert.NotNil(t, err)
+	_, err = ParseIdentity("phone", "555")
+	assert.NotNil(t, err)
+}
+
+func TestMergedUser(t *testing.T) {
+	target := User{ID: "target", Level: 10, Coins: 500, Inventory: map[string]int{ItemTicket: 1}, Identities: []string{"email#a@b.c"}}
+	guest := User{ID: "guest", Level: 12, Coins: 100, Inventory: map[string]int{ItemTicket: 2, ItemLife: 1}, Identities: []string{"device#1"}}
+	merged := MergedUser(target, guest)
+	assert.Equal(t, 600, merged.Coins)
+	assert.Equal(t, 12, merged.Level)
+	assert.Equal(t, map[string]int{ItemTicket: 3, ItemLife: 1}, merged.Inventory)
+	assert.Equal(t, []string{"email#a@b.c", "device#1"}, merged.Identities)
+
+	// The target is not changed
+	assert.Equal(t, 500, target.Coins)
+	assert.Equal(t, []string{"email#a@b.c"}, target.Identities)
+}
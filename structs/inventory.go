@@ -0,0 +1,130 @@
+package structs
+
+import (
+	"errors"
+	"oguzhanakan0/good-blast-api/config"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	ItemTicket        = "ticket"
+	ItemLife          = "life"
+	ItemBoosterRocket = "booster-rocket"
+	ItemBoosterBomb   = "booster-bomb"
+	ItemFrameGold     = "frame-gold"
+)
+
+// Ways of paying the entry cost of a tournament.
+const (
+	PaymentCoins  = "coins"
+	PaymentTicket = ItemTicket
+)
+
+type Item struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Consumable bool   `json:"consumable"` // false for cosmetic items, which are kept once granted
+}
+
+// All items a user can own.
+var Items = map[string]Item{
+	ItemTicket:        {ID: ItemTicket, Name: "Tournament Ticket", Consumable: true},
+	ItemLife:          {ID: ItemLife, Name: "Life", Consumable: true},
+	ItemBoosterRocket: {ID: ItemBoosterRocket, Name: "Rocket Booster", Consumable: true},
+	ItemBoosterBomb:   {ID: ItemBoosterBomb, Name: "Bomb Booster", Consumable: true},
+	ItemFrameGold:     {ID: ItemFrameGold, Name: "Golden Frame", Consumable: false},
+}
+
+// Coins and items earned in a tournament.
+type Reward struct {
+	Coins int            `json:"coins"`
+	Items map[string]int `json:"items,omitempty"` // format: { itemID: quantity }
+}
+
+func (r Reward) IsEmpty() bool {
+	return r.Coins == 0 && len(r.Items) == 0
+}
+
+// Returns the items earned by finishing a group at the given zero-based rank.
+func ItemsForRank(rank int) map[string]int {
+	if rank < 0 || rank >= len(config.TournamentItemRewards) {
+		return nil
+	}
+	return config.TournamentItemRewards[rank]
+}
+
+// Returns the coins and items earned by finishing a group at the given zero-based rank.
+func RankReward(rank int) Reward {
+	return Reward{Coins: RewardForRank(rank), Items: ItemsForRank(rank)}
+}
+
+// Makes sure the user has an inventory map, so that single items can be updated in it.
+func (u *User) ensureInventory(db *dynamodb.DynamoDB) error {
+	return u.ensureMap(db, "inventory")
+}
+
+// Returns an update expression that adds the given items to the inventory, and
+// fills in its attribute names and values.
+func inventoryUpdate(items map[string]int, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	expr := ""
+	i := 0
+	for item, quantity := range items {
+		name, value := "#item"+strconv.Itoa(i), ":item"+strconv.Itoa(i)
+		if expr != "" {
+			expr += ", "
+		}
+		expr += "inventory." + name + " = if_not_exists(inventory." + name + ", :zero) + " + value
+		names[name] = aws.String(item)
+		values[value] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(quantity))}
+		i++
+	}
+	values[":zero"] = &dynamodb.AttributeValue{N: aws.String("0")}
+	return expr
+}
+
+// Removes the given quantity of an item from the user's inventory. Fails if the
+// user does not have enough of the item.
+func (u *User) ConsumeItem(db *dynamodb.DynamoDB, item string, quantity int) error {
+	if def, ok := Items[item]; !ok || !def.Consumable {
+		return errors.New("Item cannot be consumed.")
+	}
+	if quantity < 1 {
+		return errors.New("Quantity must be positive.")
+	}
+	// The items and their ledger entry are written in one transaction
+	ledger, err := ledgerPuts(NewItemLedgerEntries(u.ID, LedgerReasonItemConsumed, map[string]int{item: -quantity}, "")...)
+	if err != nil {
+		return err
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:    aws.String("SET inventory.#item = inventory.#item - :quantity"),
+					ConditionExpression: aws.String("inventory.#item >= :quantity"),
+					ExpressionAttributeNames: map[string]*string{
+						"#item": aws.String(item),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":quantity": {N: aws.String(strconv.Itoa(quantity))},
+					},
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if len(failedConditions(err)) > 0 {
+			return errors.New("Not enough items in the inventory.")
+		}
+		return err
+	}
+	u.Inventory[item] -= quantity
+	return nil
+}
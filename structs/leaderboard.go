@@ -0,0 +1,112 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"sort"
+)
+
+// Overview of a tournament's results, used to preview finalization.
+type TournamentSummary struct {
+	TournamentID string                 `json:"tournamentID"`
+	Participants int                    `json:"participants"`
+	Countries    map[string]int         `json:"countries"` // format: { countryCode: number of participants }
+	Top          []UserTournamentRecord `json:"top"`
+	TotalPayout  int                    `json:"totalPayout"` // coins to be paid out if every reward is claimed, team rewards included
+	TotalItems   map[string]int         `json:"totalItems"`  // format: { itemID: quantity to be given out if every reward is claimed }
+}
+
+// A position that differs between two versions of the same leaderboard.
+type LeaderboardChange struct {
+	Country  string `json:"country"`
+	Position int    `json:"position"` // zero-based
+	Old      string `json:"old"`      // user ID, empty if the position did not exist
+	New      string `json:"new"`      // user ID, empty if the position does not exist anymore
+}
+
+// Returns the coins earned by finishing a group at the given zero-based rank.
+func RewardForRank(rank int) int {
+	switch {
+	case rank > config.TournamentRewardMaxRank:
+		return 0
+	case rank == 0:
+		return config.TournamentReward1
+	case rank == 1:
+		return config.TournamentReward2
+	case rank == 2:
+		return config.TournamentReward3
+	default:
+		return config.TournamentRewardDefault
+	}
+}
+
+// Returns the players of a group sorted by score, highest first.
+func (g *Group) Ranking() []UserTournamentRecord {
+	players := append([]UserTournamentRecord{}, g.Players...)
+	sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+	return players
+}
+
+// Summarizes the results of a tournament from its groups. Top contains at most topN players.
+// In a team tournament the players are teams, and each team's coins are counted in
+// full although only the members who contributed are paid. Teams earn no items.
+func SummarizeTournament(t *Tournament, groups []Group, topN int) TournamentSummary {
+	summary := TournamentSummary{TournamentID: t.ID, Countries: map[string]int{}, TotalItems: map[string]int{}}
+	var players []UserTournamentRecord
+	for _, group := range groups {
+		for rank, p := range group.Ranking() {
+			summary.Participants++
+			summary.Countries[p.Country]++
+			reward := RankReward(rank)
+			summary.TotalPayout += reward.Coins
+			if !t.Team {
+				for itemID, quantity := range reward.Items {
+					summary.TotalItems[itemID] += quantity
+				}
+			}
+			players = append(players, p)
+		}
+	}
+	sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+	if len(players) > topN {
+		players = players[:topN]
+	}
+	summary.Top = players
+	return summary
+}
+
+// Returns every position that differs between the old and new leaderboards, ordered
+// by country and position.
+func DiffLeaderboards(old map[string][]string, new map[string][]string) []LeaderboardChange {
+	countries := map[string]bool{}
+	for country := range old {
+		countries[country] = true
+	}
+	for country := range new {
+		countries[country] = true
+	}
+	var sorted []string
+	for country := range countries {
+		sorted = append(sorted, country)
+	}
+	sort.Strings(sorted)
+
+	changes := []LeaderboardChange{}
+	for _, country := range sorted {
+		o, n := old[country], new[country]
+		for i := 0; i < len(o) || i < len(n); i++ {
+			var change LeaderboardChange
+			if i < len(o) {
+				change.Old = o[i]
+			}
+			if i < len(n) {
+				change.New = n[i]
+			}
+			if change.Old != change.New {
+				change.Country = country
+				change.Position = i
+				changes = append(changes, change)
+			}
+		}
+	}
+	return changes
+}
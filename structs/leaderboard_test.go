@@ -0,0 +1,42 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSummarizeTournament(t *testing.T) {
+	groups := []Group{
+		{GroupID: 1, Players: []UserTournamentRecord{
+			{UserID: "a", Score: 1, Country: "TR"},
+			{UserID: "b", Score: 5, Country: "US"},
+		}},
+		{GroupID: 2, Players: []UserTournamentRecord{
+			{UserID: "c", Score: 3, Country: "TR"},
+		}},
+	}
+	summary := SummarizeTournament(&Tournament{ID: "2000-01-01"}, groups, 2)
+	assert.Equal(t, 3, summary.Participants)
+	assert.Equal(t, map[string]int{"TR": 2, "US": 1}, summary.Countries)
+	assert.Equal(t, []string{"b", "c"}, []string{summary.Top[0].UserID, summary.Top[1].UserID})
+	assert.Equal(t, 2*config.TournamentReward1+config.TournamentReward2, summary.TotalPayout)
+	assert.Equal(t, map[string]int{"ticket": 3, "booster-rocket": 5, "frame-gold": 2}, summary.TotalItems)
+
+	// Teams are paid coins only
+	summary = SummarizeTournament(&Tournament{ID: "team-2000-01-01", Team: true}, groups, 2)
+	assert.Equal(t, 2*config.TournamentReward1+config.TournamentReward2, summary.TotalPayout)
+	assert.Empty(t, summary.TotalItems)
+}
+
+func TestDiffLeaderboards(t *testing.T) {
+	old := map[string][]string{"ALL": {"a", "b"}, "TR": {"a"}}
+	new := map[string][]string{"ALL": {"b", "a", "c"}, "TR": {"a"}}
+	changes := DiffLeaderboards(old, new)
+	assert.Equal(t, []LeaderboardChange{
+		{Country: "ALL", Position: 0, Old: "a", New: "b"},
+		{Country: "ALL", Position: 1, Old: "b", New: "a"},
+		{Country: "ALL", Position: 2, Old: "", New: "c"},
+	}, changes)
+}
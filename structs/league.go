@@ -0,0 +1,160 @@
+package structs
+
+import (
+	"slices"
+	"time"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const (
+	LeaguePromoted  = "promoted"
+	LeagueRelegated = "relegated"
+)
+
+// A move of a user between leagues at the end of a tournament.
+type LeagueChange struct {
+	TournamentID string `json:"tournamentID"`
+	From         string `json:"from"`
+	To           string `json:"to"`
+	GroupRank    int    `json:"groupRank"` // one-based
+	ChangedAt    string `json:"changedAt"` // RFC3339
+}
+
+// Returns the league the user is in. Users who have never been promoted are in
+// the lowest league.
+func (u *User) CurrentLeague() string {
+	if slices.Contains(config.Leagues, u.League) {
+		return u.League
+	}
+	return config.Leagues[0]
+}
+
+// Returns the league above or below the given one for the result, or the same
+// league if there is none.
+func NextLeague(league string, result string) string {
+	i := slices.Index(config.Leagues, league)
+	if i < 0 {
+		return league
+	}
+	switch {
+	case result == LeaguePromoted && i+1 < len(config.Leagues):
+		return config.Leagues[i+1]
+	case result == LeagueRelegated && i > 0:
+		return config.Leagues[i-1]
+	default:
+		return league
+	}
+}
+
+// Returns the players of a league group who move to another league, mapped to
+// their result. The top config.LeaguePromotions players who scored are promoted
+// and the bottom config.LeagueRelegations are relegated; nobody leaves the top or
+// the bottom league in that direction.
+func LeagueResults(g Group) map[string]string {
+	results := map[string]string{}
+	ranking := g.Ranking()
+	top := slices.Index(config.Leagues, g.League) == len(config.Leagues)-1
+	bottom := slices.Index(config.Leagues, g.League) == 0
+	for rank, p := range ranking {
+		if rank < config.LeaguePromotions && p.Score > 0 {
+			if !top {
+				results[p.UserID] = LeaguePromoted
+			}
+		} else if rank >= len(ranking)-config.LeagueRelegations && !bottom {
+			results[p.UserID] = LeagueRelegated
+		}
+	}
+	return results
+}
+
+// Promotes and relegates the players of every league group in the tournament.
+// A user moves at most once per tournament, so the moves are kept as they are
+// when the tournament is recalculated.
+func (t *Tournament) moveLeagues(db *dynamodb.DynamoDB, groups []Group) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, group := range groups {
+		if !slices.Contains(config.Leagues, group.League) {
+			continue
+		}
+		results := LeagueResults(group)
+		for rank, p := range group.Ranking() {
+			result, ok := results[p.UserID]
+			if !ok {
+				continue
+			}
+			change := LeagueChange{
+				TournamentID: t.ID,
+				From:         group.League,
+				To:           NextLeague(group.League, result),
+				GroupRank:    rank + 1,
+				ChangedAt:    now,
+			}
+			err := setLeague(db, p.UserID, change, result)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Moves the user to the league of the change and adds it to their history,
+// unless the user has already moved because of the same tournament. The user is
+// only moved if they are still in the league they played in; otherwise only the
+// result is recorded.
+func setLeague(db *dynamodb.DynamoDB, userID string, change LeagueChange, result string) error {
+	av, err := dynamodbattribute.MarshalMap(change)
+	if err != nil {
+		return err
+	}
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(userID)},
+	}
+	names := map[string]*string{
+		"#tid": aws.String(change.TournamentID),
+	}
+	condition := "attribute_exists(tournaments.#tid) AND attribute_not_exists(tournaments.#tid.leagueResult)"
+	from := "league = :from"
+	if change.From == config.Leagues[0] {
+		from = "(attribute_not_exists(league) OR league = :from)"
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String("user"),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET league = :league, leagueHistory = list_append(if_not_exists(leagueHistory, :empty), :change), tournaments.#tid.leagueResult = :result"),
+		ConditionExpression:      aws.String(condition + " AND " + from),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":league": {S: aws.String(change.To)},
+			":from":   {S: aws.String(change.From)},
+			":empty":  {L: []*dynamodb.AttributeValue{}},
+			":change": {L: []*dynamodb.AttributeValue{{M: av}}},
+			":result": {S: aws.String(result)},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+		return err
+	}
+	// The user is in another league now, record the result without moving them
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String("user"),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET tournaments.#tid.leagueResult = :result"),
+		ConditionExpression:      aws.String(condition),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":result": {S: aws.String(result)},
+		},
+	})
+	// Already moved, or the user has been deleted
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
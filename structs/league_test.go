@@ -0,0 +1,40 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextLeague(t *testing.T) {
+	assert.Equal(t, config.Leagues[1], NextLeague(config.Leagues[0], LeaguePromoted))
+	assert.Equal(t, config.Leagues[0], NextLeague(config.Leagues[1], LeagueRelegated))
+	assert.Equal(t, config.Leagues[0], NextLeague(config.Leagues[0], LeagueRelegated))
+	top := config.Leagues[len(config.Leagues)-1]
+	assert.Equal(t, top, NextLeague(top, LeaguePromoted))
+}
+
+func TestCurrentLeague(t *testing.T) {
+	u := User{}
+	assert.Equal(t, config.Leagues[0], u.CurrentLeague())
+	u.League = config.Leagues[2]
+	assert.Equal(t, config.Leagues[2], u.CurrentLeague())
+}
+
+func TestLeagueResults(t *testing.T) {
+	var players []UserTournamentRecord
+	for i := 0; i < 10; i++ {
+		players = append(players, UserTournamentRecord{UserID: string(rune('a' + i)), Score: 10 - i})
+	}
+	results := LeagueResults(Group{League: config.Leagues[1], Players: players})
+	assert.Equal(t, map[string]string{
+		"a": LeaguePromoted, "b": LeaguePromoted, "c": LeaguePromoted,
+		"h": LeagueRelegated, "i": LeagueRelegated, "j": LeagueRelegated,
+	}, results)
+
+	// Nobody is relegated from the lowest league or promoted without scoring
+	players[1].Score, players[2].Score = 0, 0
+	results = LeagueResults(Group{League: config.Leagues[0], Players: players[:3]})
+	assert.Equal(t, map[string]string{"a": LeaguePromoted}, results)
+}
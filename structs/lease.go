@@ -0,0 +1,161 @@
+package structs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/google/uuid"
+)
+
+var ErrLeaseHeld = errors.New("Lease is held by another owner.")
+
+// A lease gives its owner exclusive access to a named resource until it expires.
+// An expired lease can be taken over by anyone.
+type Lease struct {
+	Name      string `json:"name"`
+	Owner     string `json:"owner"`
+	ExpiresAt int64  `json:"expiresAt"` // unix seconds
+}
+
+// Returns an owner ID that is unique to this process.
+func NewLeaseOwner() string {
+	host, _ := os.Hostname()
+	return host + "#" + (uuid.New()).String()
+}
+
+// Acquires the lease, or renews it if it is already held by the same owner.
+// Returns ErrLeaseHeld if another owner holds an unexpired lease.
+func (l *Lease) Acquire(db *dynamodb.DynamoDB) error {
+	now := time.Now().UTC()
+	expiresAt := now.Add(config.LeaseDurationSeconds * time.Second).Unix()
+	_, err := db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("lease"),
+		Item: map[string]*dynamodb.AttributeValue{
+			"name":      {S: aws.String(l.Name)},
+			"owner":     {S: aws.String(l.Owner)},
+			"expiresAt": {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(#name) OR expiresAt < :now OR #owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#name":  aws.String("name"),
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":now":   {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+			":owner": {S: aws.String(l.Owner)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrLeaseHeld
+		}
+		return err
+	}
+	l.ExpiresAt = expiresAt
+	return nil
+}
+
+// Extends the lease if it is still held by the owner.
+func (l *Lease) Renew(db *dynamodb.DynamoDB) error {
+	expiresAt := time.Now().UTC().Add(config.LeaseDurationSeconds * time.Second).Unix()
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("lease"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"name": {S: aws.String(l.Name)},
+		},
+		UpdateExpression:    aws.String("SET expiresAt = :expiresAt"),
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":expiresAt": {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+			":owner":     {S: aws.String(l.Owner)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrLeaseHeld
+		}
+		return err
+	}
+	l.ExpiresAt = expiresAt
+	return nil
+}
+
+// Deletes the lease if it is still held by the owner.
+func (l *Lease) Release(db *dynamodb.DynamoDB) error {
+	_, err := db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("lease"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"name": {S: aws.String(l.Name)},
+		},
+		ConditionExpression: aws.String("#owner = :owner"),
+		ExpressionAttributeNames: map[string]*string{
+			"#owner": aws.String("owner"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":owner": {S: aws.String(l.Owner)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// Renews the lease periodically until the returned function is called. The
+// returned context is cancelled when the lease is lost, either because another
+// owner has taken it over or because it has expired before it could be renewed,
+// so that the holder stops before writing anything else.
+func (l *Lease) KeepAlive(db *dynamodb.DynamoDB) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(config.LeaseDurationSeconds * time.Second / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := l.Renew(db)
+				if err == ErrLeaseHeld || (err != nil && time.Now().Unix() >= l.ExpiresAt) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// Returns a condition check that fails unless the lease is still held by the owner,
+// to make a write in a transaction depend on the lease.
+func (l *Lease) conditionCheck() *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		ConditionCheck: &dynamodb.ConditionCheck{
+			TableName: aws.String("lease"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"name": {S: aws.String(l.Name)},
+			},
+			ConditionExpression: aws.String("#owner = :owner"),
+			ExpressionAttributeNames: map[string]*string{
+				"#owner": aws.String("owner"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":owner": {S: aws.String(l.Owner)},
+			},
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package structs
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+const (
+	LedgerReasonTournamentRefund = "tournament-refund"
+	LedgerReasonAdminGrant       = "admin-grant"
+	LedgerReasonTournamentReward = "tournament-reward"
+	LedgerReasonLifePurchase     = "life-purchase"
+	LedgerReasonAccountMerge     = "account-merge"
+	LedgerReasonTeamReward       = "team-reward"
+	LedgerReasonDailyBonus       = "daily-bonus"
+	LedgerReasonAchievement      = "achievement"
+	LedgerReasonTournamentEntry  = "tournament-entry"
+	LedgerReasonItemConsumed     = "item-consumed"
+)
+
+// A single change on a user's balance. Entries are keyed by userID and a
+// timestamp-prefixed ID so that querying a user's ledger returns them in order.
+type LedgerEntry struct {
+	UserID       string `json:"userID"`
+	ID           string `json:"id"`
+	Reason       string `json:"reason"`
+	Amount       int    `json:"amount"`         // coins, or quantity if Item is set
+	Item         string `json:"item,omitempty"` // set if the entry is an item instead of coins
+	TournamentID string `json:"tournamentID,omitempty"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+func NewLedgerEntry(userID string, reason string, amount int, tournamentID string) LedgerEntry {
+	now := time.Now().UTC()
+	return LedgerEntry{
+		UserID:       userID,
+		ID:           now.Format(time.RFC3339Nano) + "#" + (uuid.New()).String(),
+		Reason:       reason,
+		Amount:       amount,
+		TournamentID: tournamentID,
+		CreatedAt:    now.Format(time.RFC3339),
+	}
+}
+
+// Returns an entry for each item, with the quantity as the amount. Entries are in
+// the order of the item names.
+func NewItemLedgerEntries(userID string, reason string, items map[string]int, tournamentID string) []LedgerEntry {
+	var names []string
+	for item := range items {
+		names = append(names, item)
+	}
+	sort.Strings(names)
+	var entries []LedgerEntry
+	for _, item := range names {
+		entry := NewLedgerEntry(userID, reason, items[item], tournamentID)
+		entry.Item = item
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// Returns the writes that store the entries in a transaction.
+func ledgerPuts(entries ...LedgerEntry) ([]*dynamodb.TransactWriteItem, error) {
+	var items []*dynamodb.TransactWriteItem
+	for _, entry := range entries {
+		av, err := dynamodbattribute.MarshalMap(entry)
+		if err != nil {
+			return nil, errors.New("Cannot marshal the ledger entry.")
+		}
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String("ledger"),
+				Item:      av,
+			},
+		})
+	}
+	return items, nil
+}
+
+func (e *LedgerEntry) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error) {
+	av, err := dynamodbattribute.MarshalMap(e)
+	if err != nil {
+		return nil, errors.New("Cannot marshal the ledger entry.")
+	}
+	out, err := db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("ledger"),
+		Item:      av,
+	})
+	return out, err
+}
+
+// Returns all ledger entries of a user, oldest first.
+func FetchLedger(db *dynamodb.DynamoDB, userID string) ([]LedgerEntry, error) {
+	var entries []LedgerEntry
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("ledger"),
+		KeyConditionExpression: aws.String("userID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userID": {S: aws.String(userID)},
+		},
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, e := range out.Items {
+			var entry LedgerEntry
+			dynamodbattribute.UnmarshalMap(e, &entry)
+			entries = append(entries, entry)
+		}
+		return true
+	})
+	return entries, err
+}
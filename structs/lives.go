@@ -0,0 +1,226 @@
+package structs
+
+import (
+	"errors"
+	"oguzhanakan0/good-blast-api/config"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoLives      = errors.New("User has no lives left.")
+	ErrNoAttempt    = errors.New("Level attempt does not exist.")
+	ErrLivesChanged = errors.New("Lives have changed, please try again.")
+	ErrTooManyLives = errors.New("Cannot have more lives than the maximum.")
+)
+
+// A level the user has started playing but not finished yet.
+type LevelAttempt struct {
+	ID        string `json:"id"`
+	Level     int    `json:"level"`
+	StartedAt string `json:"startedAt"` // RFC3339
+}
+
+// State of a user's lives at a point in time.
+type LivesStatus struct {
+	Lives      int    `json:"lives"`
+	MaxLives   int    `json:"maxLives"`
+	NextLifeAt string `json:"nextLifeAt,omitempty"` // RFC3339, empty if lives are full
+}
+
+// Changes that are written together with a user's lives.
+type livesUpdate struct {
+	Expr      string
+	Condition string
+	Names     map[string]*string
+	Values    map[string]*dynamodb.AttributeValue
+	Entry     *LedgerEntry
+}
+
+// Adds the lives regenerated since the last refill, up to config.UserMaxLives.
+// Lives are not stored on every regeneration; they are calculated whenever read.
+func (u *User) RegenerateLives(now time.Time) {
+	refilledAt, err := time.Parse(time.RFC3339, u.LivesRefilledAt)
+	// Users without a refill time have never spent a life
+	if err != nil {
+		u.Lives = config.UserMaxLives
+		u.LivesRefilledAt = now.Format(time.RFC3339)
+		return
+	}
+	interval := config.LifeRegenMinutes * time.Minute
+	if u.Lives < config.UserMaxLives && now.After(refilledAt) {
+		regenerated := int(now.Sub(refilledAt) / interval)
+		u.Lives = min(u.Lives+regenerated, config.UserMaxLives)
+		refilledAt = refilledAt.Add(time.Duration(regenerated) * interval)
+	}
+	// Regeneration clock only runs while lives are not full
+	if u.Lives >= config.UserMaxLives {
+		refilledAt = now
+	}
+	u.LivesRefilledAt = refilledAt.Format(time.RFC3339)
+}
+
+// Returns the user's lives at the given time.
+func (u *User) LivesStatus(now time.Time) LivesStatus {
+	u.RegenerateLives(now)
+	status := LivesStatus{Lives: u.Lives, MaxLives: config.UserMaxLives}
+	if u.Lives < config.UserMaxLives {
+		refilledAt, _ := time.Parse(time.RFC3339, u.LivesRefilledAt)
+		status.NextLifeAt = refilledAt.Add(config.LifeRegenMinutes * time.Minute).Format(time.RFC3339)
+	}
+	return status
+}
+
+// Writes the user's lives and attempt together with the given update, only if the
+// lives in database are still the ones the user was fetched with.
+func (u *User) saveLives(db *dynamodb.DynamoDB, prevLives int, prevRefilledAt string, update livesUpdate) error {
+	values := update.Values
+	if values == nil {
+		values = map[string]*dynamodb.AttributeValue{}
+	}
+	attempt, _ := dynamodbattribute.Marshal(u.Attempt)
+	values[":lives"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(u.Lives))}
+	values[":refilledAt"] = &dynamodb.AttributeValue{S: aws.String(u.LivesRefilledAt)}
+	values[":attempt"] = attempt
+	// Empty strings are stored as NULL
+	condition := "attribute_not_exists(livesRefilledAt) OR attribute_type(livesRefilledAt, :null)"
+	values[":null"] = &dynamodb.AttributeValue{S: aws.String("NULL")}
+	if prevRefilledAt != "" {
+		delete(values, ":null")
+		condition = "lives = :prevLives AND livesRefilledAt = :prevRefilledAt"
+		values[":prevLives"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(prevLives))}
+		values[":prevRefilledAt"] = &dynamodb.AttributeValue{S: aws.String(prevRefilledAt)}
+	}
+	if update.Condition != "" {
+		condition = "(" + condition + ") AND " + update.Condition
+	}
+	expr := "SET lives = :lives, livesRefilledAt = :refilledAt, attempt = :attempt"
+	if update.Expr != "" {
+		expr += ", " + update.Expr
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String("user"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(u.ID)},
+				},
+				UpdateExpression:          aws.String(expr),
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeNames:  update.Names,
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	if update.Entry != nil {
+		av, err := dynamodbattribute.MarshalMap(update.Entry)
+		if err != nil {
+			return errors.New("Cannot marshal the ledger entry.")
+		}
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName: aws.String("ledger"),
+				Item:      av,
+			},
+		})
+	}
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+		return ErrLivesChanged
+	}
+	return err
+}
+
+// Starts playing the user's current level. A life is spent, or a life item from
+// the inventory if the user has no lives left.
+func (u *User) StartAttempt(db *dynamodb.DynamoDB, now time.Time) (LevelAttempt, error) {
+	prevLives, prevRefilledAt := u.Lives, u.LivesRefilledAt
+	u.RegenerateLives(now)
+	attempt := LevelAttempt{
+		ID:        (uuid.New()).String(),
+		Level:     u.Level,
+		StartedAt: now.Format(time.RFC3339),
+	}
+
+	var update livesUpdate
+	if u.Lives > 0 {
+		u.Lives--
+	} else if u.Inventory[ItemLife] > 0 {
+		update = livesUpdate{
+			Expr:      "inventory.#life = inventory.#life - :one",
+			Condition: "inventory.#life >= :one",
+			Names:     map[string]*string{"#life": aws.String(ItemLife)},
+			Values:    map[string]*dynamodb.AttributeValue{":one": {N: aws.String("1")}},
+		}
+	} else {
+		return attempt, ErrNoLives
+	}
+	u.Attempt = &attempt
+	err := u.saveLives(db, prevLives, prevRefilledAt, update)
+	if err != nil {
+		return attempt, err
+	}
+	if update.Names != nil {
+		u.Inventory[ItemLife]--
+	}
+	return attempt, nil
+}
+
+// Ends the user's current attempt as failed. The life spent on the attempt is lost.
+func (u *User) FailAttempt(db *dynamodb.DynamoDB, attemptID string, now time.Time) error {
+	if u.Attempt == nil || u.Attempt.ID != attemptID {
+		return ErrNoAttempt
+	}
+	prevLives, prevRefilledAt := u.Lives, u.LivesRefilledAt
+	u.RegenerateLives(now)
+	u.Attempt = nil
+	err := u.saveLives(db, prevLives, prevRefilledAt, livesUpdate{
+		// A failure ends the streak of completed levels
+		Expr:      "streak = :zero",
+		Condition: "attempt.id = :attemptID",
+		Values: map[string]*dynamodb.AttributeValue{
+			":attemptID": {S: aws.String(attemptID)},
+			":zero":      {N: aws.String("0")},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	u.Streak = 0
+	return nil
+}
+
+// Buys the given number of lives with coins. Lives cannot exceed config.UserMaxLives.
+func (u *User) BuyLives(db *dynamodb.DynamoDB, quantity int, now time.Time) error {
+	if quantity < 1 {
+		return errors.New("Quantity must be positive.")
+	}
+	prevLives, prevRefilledAt := u.Lives, u.LivesRefilledAt
+	u.RegenerateLives(now)
+	if u.Lives+quantity > config.UserMaxLives {
+		return ErrTooManyLives
+	}
+	cost := quantity * config.LifeCost
+	if u.Coins < cost {
+		return errors.New("Insufficient funds.")
+	}
+	u.Lives += quantity
+	entry := NewLedgerEntry(u.ID, LedgerReasonLifePurchase, -cost, "")
+	err := u.saveLives(db, prevLives, prevRefilledAt, livesUpdate{
+		Expr:      "coins = coins - :cost",
+		Condition: "coins >= :cost",
+		Values:    map[string]*dynamodb.AttributeValue{":cost": {N: aws.String(strconv.Itoa(cost))}},
+		Entry:     &entry,
+	})
+	if err != nil {
+		return err
+	}
+	u.Coins -= cost
+	return nil
+}
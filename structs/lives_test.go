@@ -0,0 +1,31 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegenerateLives(t *testing.T) {
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	interval := config.LifeRegenMinutes * time.Minute
+
+	// Users that have never spent a life have full lives
+	u := User{}
+	u.RegenerateLives(now)
+	assert.Equal(t, config.UserMaxLives, u.Lives)
+
+	// Lives regenerate one by one and the remainder is kept for the next life
+	u = User{Lives: 0, LivesRefilledAt: now.Add(-2*interval - time.Minute).Format(time.RFC3339)}
+	u.RegenerateLives(now)
+	assert.Equal(t, 2, u.Lives)
+	assert.Equal(t, now.Add(-time.Minute).Format(time.RFC3339), u.LivesRefilledAt)
+
+	// Lives never regenerate above the maximum
+	u = User{Lives: config.UserMaxLives - 1, LivesRefilledAt: now.Add(-10 * interval).Format(time.RFC3339)}
+	u.RegenerateLives(now)
+	assert.Equal(t, config.UserMaxLives, u.Lives)
+	assert.Equal(t, "", u.LivesStatus(now).NextLifeAt)
+}
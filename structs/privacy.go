@@ -0,0 +1,460 @@
+package structs
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+const (
+	DeletionPending   = "pending"
+	DeletionCompleted = "completed"
+)
+
+// Everything stored about a user, returned by GET /user/:id/export.
+type UserExport struct {
+	ExportedAt  string             `json:"exportedAt"`
+	User        User               `json:"user"`
+	Identities  []Identity         `json:"identities"`
+	Sessions    []Session          `json:"sessions"`
+	Tournaments []TournamentExport `json:"tournaments"`
+	Ledger      []LedgerEntry      `json:"ledger"`
+}
+
+// A user's participation in a tournament and their record in its group.
+type TournamentExport struct {
+	TournamentID string                `json:"tournamentID"`
+	Details      UserTournamentDetails `json:"details"`
+	Record       *UserTournamentRecord `json:"record"` // nil if the group has no record of the user
+}
+
+// Collects the user record, identities, sessions, tournament participations
+// with the user's group records, and ledger of a user.
+func ExportUser(db *dynamodb.DynamoDB, userID string) (UserExport, error) {
+	export := UserExport{
+		ExportedAt:  time.Now().UTC().Format(time.RFC3339),
+		User:        User{ID: userID},
+		Identities:  []Identity{},
+		Tournaments: []TournamentExport{},
+	}
+	err := export.User.Fetch(db)
+	if err != nil {
+		return export, err
+	}
+	for _, id := range export.User.Identities {
+		identity := Identity{ID: id}
+		if err := identity.Fetch(db); err != nil {
+			continue
+		}
+		export.Identities = append(export.Identities, identity)
+	}
+	export.Sessions, err = FetchSessions(db, userID)
+	if err != nil {
+		return export, err
+	}
+	for tournamentID, details := range export.User.Tournaments {
+		record := TournamentExport{TournamentID: tournamentID, Details: details}
+		group := Group{TournamentID: tournamentID, GroupID: details.GroupID}
+		if err := group.Fetch(db); err == nil {
+			for _, p := range group.Players {
+				if p.UserID == userID {
+					record.Record = &p
+					break
+				}
+			}
+		}
+		export.Tournaments = append(export.Tournaments, record)
+	}
+	export.Ledger, err = FetchLedger(db, userID)
+	if export.Ledger == nil {
+		export.Ledger = []LedgerEntry{}
+	}
+	return export, err
+}
+
+// A request to delete a user. The user is replaced by a random pseudonym in
+// group records and leaderboards, so that scores and ranks of other players are
+// kept, then all other data of the user is deleted. Each step can be repeated,
+// so a deletion that fails halfway is resumed by running it again.
+type Deletion struct {
+	UserID      string         `json:"userID"`
+	Pseudonym   string         `json:"pseudonym,omitempty"` // removed once the deletion is completed
+	Status      string         `json:"status"`
+	Tournaments map[string]int `json:"tournaments"` // format: { tournamentID: groupID }, removed once anonymized
+	RequestedAt string         `json:"requestedAt"`
+	CompletedAt string         `json:"completedAt,omitempty"`
+}
+
+// Stores a deletion request for the user. If the user has already requested a
+// deletion, the existing request is returned instead.
+func RequestDeletion(db *dynamodb.DynamoDB, u User) (Deletion, error) {
+	d := Deletion{
+		UserID:      u.ID,
+		Pseudonym:   "deleted#" + (uuid.New()).String(),
+		Status:      DeletionPending,
+		Tournaments: map[string]int{},
+		RequestedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	for tournamentID, details := range u.Tournaments {
+		d.Tournaments[tournamentID] = details.GroupID
+	}
+	av, err := dynamodbattribute.MarshalMap(d)
+	if err != nil {
+		return d, errors.New("Cannot marshal the deletion.")
+	}
+	_, err = db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("deletion"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(userID)"),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		err = d.Fetch(db)
+	}
+	return d, err
+}
+
+func (d *Deletion) Fetch(db *dynamodb.DynamoDB) error {
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("deletion"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userID": {S: aws.String(d.UserID)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if out.Item == nil {
+		return errors.New("Could not find deletion.")
+	}
+	return dynamodbattribute.UnmarshalMap(out.Item, d)
+}
+
+// Returns the deletions that have not been completed yet.
+func FetchPendingDeletions(db *dynamodb.DynamoDB) ([]Deletion, error) {
+	var deletions []Deletion
+	err := db.ScanPages(&dynamodb.ScanInput{
+		TableName:        aws.String("deletion"),
+		FilterExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":pending": {S: aws.String(DeletionPending)},
+		},
+	}, func(out *dynamodb.ScanOutput, last bool) bool {
+		for _, e := range out.Items {
+			var d Deletion
+			dynamodbattribute.UnmarshalMap(e, &d)
+			deletions = append(deletions, d)
+		}
+		return true
+	})
+	return deletions, err
+}
+
+// Runs the remaining steps of the deletion while holding its lease.
+func (d *Deletion) Run(db *dynamodb.DynamoDB, owner string) error {
+	lease := Lease{Name: "deletion#" + d.UserID, Owner: owner}
+	err := lease.Acquire(db)
+	if err != nil {
+		return err
+	}
+	ctx, stop := lease.KeepAlive(db)
+	defer lease.Release(db)
+	defer stop()
+
+	err = d.Fetch(db)
+	if err != nil || d.Status == DeletionCompleted {
+		return err
+	}
+	// The user is logged out first, so nothing changes while the data is deleted
+	err = RevokeSessions(db, d.UserID)
+	if err != nil {
+		return err
+	}
+	// Tournaments entered after the request are anonymized as well
+	if d.Tournaments == nil {
+		d.Tournaments = map[string]int{}
+	}
+	u := User{ID: d.UserID}
+	if err := u.Fetch(db); err == nil {
+		for tournamentID, details := range u.Tournaments {
+			d.Tournaments[tournamentID] = details.GroupID
+		}
+	}
+	for tournamentID, groupID := range d.Tournaments {
+		if ctx.Err() != nil {
+			return ErrLeaseHeld
+		}
+		err = d.anonymizeTournament(db, tournamentID, groupID)
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return ErrLeaseHeld
+	}
+	err = d.anonymizeTeams(db)
+	if err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ErrLeaseHeld
+	}
+	err = d.deleteUserData(db)
+	if err != nil {
+		return err
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("deletion"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userID": {S: aws.String(d.UserID)},
+		},
+		UpdateExpression: aws.String("SET #status = :completed, completedAt = :now REMOVE pseudonym"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":completed": {S: aws.String(DeletionCompleted)},
+			":now":       {S: aws.String(time.Now().UTC().Format(time.RFC3339))},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	d.Status = DeletionCompleted
+	d.Pseudonym = ""
+	return nil
+}
+
+// Replaces the user with the pseudonym in a group record and the leaderboards
+// of the tournament, then marks the tournament as done.
+func (d *Deletion) anonymizeTournament(db *dynamodb.DynamoDB, tournamentID string, groupID int) error {
+	group := Group{TournamentID: tournamentID, GroupID: groupID}
+	if err := group.Fetch(db); err == nil {
+		for i, p := range group.Players {
+			if p.UserID != d.UserID {
+				continue
+			}
+			err := replaceUserID(db, &dynamodb.UpdateItemInput{
+				TableName: aws.String("group"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"tournamentID": {S: aws.String(tournamentID)},
+					"groupID":      {N: aws.String(strconv.Itoa(groupID))},
+				},
+			}, "players["+strconv.Itoa(i)+"].userID", nil, d.UserID, d.Pseudonym)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	t := Tournament{ID: tournamentID}
+	if err := t.Fetch(db); err == nil {
+		for country, board := range t.Leaderboards {
+			for i, userID := range board {
+				if userID != d.UserID {
+					continue
+				}
+				err := replaceUserID(db, &dynamodb.UpdateItemInput{
+					TableName: aws.String("tournament"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(tournamentID)},
+					},
+				}, "leaderboards.#country["+strconv.Itoa(i)+"]", map[string]*string{"#country": aws.String(country)}, d.UserID, d.Pseudonym)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("deletion"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userID": {S: aws.String(d.UserID)},
+		},
+		UpdateExpression: aws.String("REMOVE tournaments.#tournamentID"),
+		ExpressionAttributeNames: map[string]*string{
+			"#tournamentID": aws.String(tournamentID),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	delete(d.Tournaments, tournamentID)
+	return nil
+}
+
+// Replaces the user with the pseudonym in the contributions and paid rewards of
+// team tournaments. Teams the user has left are included, so every team is read.
+func (d *Deletion) anonymizeTeams(db *dynamodb.DynamoDB) error {
+	teams, err := FetchTeams(db)
+	if err != nil {
+		return err
+	}
+	for _, team := range teams {
+		for tournamentID, details := range team.Tournaments {
+			if points, ok := details.Contributions[d.UserID]; ok {
+				value := &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(points))}
+				err := replaceUserKey(db, team.ID, tournamentID, "contributions", value, d.UserID, d.Pseudonym)
+				if err != nil {
+					return err
+				}
+			}
+			if paid, ok := details.RewardsPaid[d.UserID]; ok {
+				value := &dynamodb.AttributeValue{BOOL: aws.Bool(paid)}
+				err := replaceUserKey(db, team.ID, tournamentID, "rewardsPaid", value, d.UserID, d.Pseudonym)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Moves the value of the user in a map of a team tournament to the pseudonym, if
+// it has not changed.
+func replaceUserKey(db *dynamodb.DynamoDB, teamID string, tournamentID string, field string, value *dynamodb.AttributeValue, userID string, pseudonym string) error {
+	path := "tournaments.#tid.#field."
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("team"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(teamID)},
+		},
+		UpdateExpression:    aws.String("SET " + path + "#pseudonym = :value REMOVE " + path + "#userID"),
+		ConditionExpression: aws.String(path + "#userID = :value"),
+		ExpressionAttributeNames: map[string]*string{
+			"#tid":       aws.String(tournamentID),
+			"#field":     aws.String(field),
+			"#userID":    aws.String(userID),
+			"#pseudonym": aws.String(pseudonym),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":value": value,
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// Already replaced by an earlier run
+		return nil
+	}
+	return err
+}
+
+// Sets the attribute at path to the pseudonym if it still holds the user ID.
+func replaceUserID(db *dynamodb.DynamoDB, input *dynamodb.UpdateItemInput, path string, names map[string]*string, userID string, pseudonym string) error {
+	input.UpdateExpression = aws.String("SET " + path + " = :pseudonym")
+	input.ConditionExpression = aws.String(path + " = :userID")
+	input.ExpressionAttributeNames = names
+	input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+		":pseudonym": {S: aws.String(pseudonym)},
+		":userID":    {S: aws.String(userID)},
+	}
+	_, err := db.UpdateItem(input)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		// Already replaced by an earlier run
+		return nil
+	}
+	return err
+}
+
+// Removes the user from their team and deletes the identities, username
+// reservation, friends, sessions, ledger and record of the user.
+func (d *Deletion) deleteUserData(db *dynamodb.DynamoDB) error {
+	u := User{ID: d.UserID}
+	if err := u.Fetch(db); err != nil {
+		// Deleted by an earlier run
+		return nil
+	}
+	if u.TeamID != "" {
+		team := Team{ID: u.TeamID}
+		if err := team.Fetch(db); err == nil {
+			if err := team.Leave(db, u.ID); err != nil {
+				return err
+			}
+		}
+	}
+	var deletes []*dynamodb.DeleteItemInput
+	for _, id := range u.Identities {
+		deletes = append(deletes, &dynamodb.DeleteItemInput{
+			TableName: aws.String("identity"),
+			Key:       map[string]*dynamodb.AttributeValue{"id": {S: aws.String(id)}},
+		}, &dynamodb.DeleteItemInput{
+			TableName: aws.String("verification"),
+			Key:       map[string]*dynamodb.AttributeValue{"identityID": {S: aws.String(id)}},
+		})
+	}
+	if u.Username != "" {
+		deletes = append(deletes, &dynamodb.DeleteItemInput{
+			TableName: aws.String("username"),
+			Key:       map[string]*dynamodb.AttributeValue{"name": {S: aws.String(usernameKey(u.Username))}},
+		})
+	}
+	if u.FriendCode != "" {
+		deletes = append(deletes, &dynamodb.DeleteItemInput{
+			TableName: aws.String("friendcode"),
+			Key:       map[string]*dynamodb.AttributeValue{"code": {S: aws.String(u.FriendCode)}},
+		})
+	}
+	friends, err := FetchFriends(db, u.ID)
+	if err != nil {
+		return err
+	}
+	for _, f := range friends {
+		for _, key := range [][2]string{{f.UserID, f.FriendID}, {f.FriendID, f.UserID}} {
+			deletes = append(deletes, &dynamodb.DeleteItemInput{
+				TableName: aws.String("friend"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"userID":   {S: aws.String(key[0])},
+					"friendID": {S: aws.String(key[1])},
+				},
+			})
+		}
+	}
+	sessions, err := FetchSessions(db, u.ID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		deletes = append(deletes, &dynamodb.DeleteItemInput{
+			TableName: aws.String("session"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"userID": {S: aws.String(session.UserID)},
+				"id":     {S: aws.String(session.ID)},
+			},
+		})
+	}
+	ledger, err := FetchLedger(db, u.ID)
+	if err != nil {
+		return err
+	}
+	for _, entry := range ledger {
+		deletes = append(deletes, &dynamodb.DeleteItemInput{
+			TableName: aws.String("ledger"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"userID": {S: aws.String(entry.UserID)},
+				"id":     {S: aws.String(entry.ID)},
+			},
+		})
+	}
+	for _, input := range deletes {
+		if _, err := db.DeleteItem(input); err != nil {
+			return err
+		}
+	}
+	// The user record goes last, so a failed run finds it again
+	_, err = db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(u.ID)},
+		},
+	})
+	return err
+}
@@ -0,0 +1,178 @@
+package structs
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	ErrUnknownAvatar    = errors.New("Avatar is not known.")
+	ErrTimezoneCooldown = errors.New("Timezone was changed recently.")
+)
+
+// Changes to a user's profile. Nil fields are not changed.
+type ProfileUpdate struct {
+	Username *string `json:"username"`
+	Country  *string `json:"country"`
+	Avatar   *string `json:"avatar"`
+	Timezone *string `json:"timezone"` // IANA name, e.g. Europe/Istanbul
+}
+
+// Validates and normalizes the changed fields.
+func (p *ProfileUpdate) Normalize() error {
+	if p.Username != nil {
+		username, err := NormalizeUsername(*p.Username)
+		if err != nil {
+			return err
+		}
+		p.Username = &username
+	}
+	if p.Country != nil {
+		country, err := NormalizeCountry(*p.Country)
+		if err != nil {
+			return err
+		}
+		p.Country = &country
+	}
+	if p.Avatar != nil && !slices.Contains(config.Avatars, *p.Avatar) {
+		return ErrUnknownAvatar
+	}
+	if p.Timezone != nil {
+		if _, err := LoadTimezone(*p.Timezone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns true if a change made at changedAt, an RFC3339 time or empty if there
+// was none, is older than the given number of days.
+func cooledDown(changedAt string, days int, now time.Time) bool {
+	if changedAt == "" {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339, changedAt)
+	return err != nil || !now.Before(t.AddDate(0, 0, days))
+}
+
+// Applies a normalized profile update. A new username is reserved and the old
+// one released; usernames can be changed once every
+// config.UsernameRenameCooldownDays days. The timezone can be changed once every
+// config.TimezoneChangeCooldownDays days, so that daily bonus days cannot be
+// repeated by moving between timezones. A new country applies to tournaments
+// entered afterwards: players stay on the country leaderboard they entered a
+// tournament with.
+func (u *User) UpdateProfile(db *dynamodb.DynamoDB, p ProfileUpdate, now time.Time) error {
+	rename := p.Username != nil && *p.Username != u.Username
+	if rename && !cooledDown(u.UsernameChangedAt, config.UsernameRenameCooldownDays, now) {
+		return ErrRenameCooldown
+	}
+	rezone := p.Timezone != nil && *p.Timezone != u.Timezone
+	if rezone && !cooledDown(u.TimezoneChangedAt, config.TimezoneChangeCooldownDays, now) {
+		return ErrTimezoneCooldown
+	}
+
+	expr := ""
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	set := func(field string, value string) {
+		if expr != "" {
+			expr += ", "
+		}
+		expr += "#" + field + " = :" + field
+		names["#"+field] = aws.String(field)
+		values[":"+field] = &dynamodb.AttributeValue{S: aws.String(value)}
+	}
+	if rename {
+		set("username", *p.Username)
+		set("usernameChangedAt", now.Format(time.RFC3339))
+	}
+	if p.Country != nil && *p.Country != u.Country {
+		set("country", *p.Country)
+	}
+	if p.Avatar != nil && *p.Avatar != u.Avatar {
+		set("avatar", *p.Avatar)
+	}
+	if rezone {
+		set("timezone", *p.Timezone)
+		set("timezoneChangedAt", now.Format(time.RFC3339))
+	}
+	if expr == "" {
+		return nil
+	}
+
+	// The username must not have changed since it was read
+	names["#username"] = aws.String("username")
+	values[":old"] = &dynamodb.AttributeValue{S: aws.String(u.Username)}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String("user"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(u.ID)},
+				},
+				UpdateExpression:          aws.String("SET " + expr),
+				ConditionExpression:       aws.String("#username = :old"),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	// Only a change of case keeps the reservation
+	if rename && usernameKey(*p.Username) != usernameKey(u.Username) {
+		reservation, err := reservationPut(*p.Username, u.ID)
+		if err != nil {
+			return err
+		}
+		items = append(items, &dynamodb.TransactWriteItem{Put: reservation}, &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				TableName: aws.String("username"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"name": {S: aws.String(usernameKey(u.Username))},
+				},
+				ConditionExpression: aws.String("attribute_not_exists(#name) OR userID = :userID"),
+				ExpressionAttributeNames: map[string]*string{
+					"#name": aws.String("name"),
+				},
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":userID": {S: aws.String(u.ID)},
+				},
+			},
+		})
+	}
+
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		for _, i := range failedConditions(err) {
+			if i == 1 {
+				return ErrUsernameTaken
+			}
+		}
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return ErrUserChanged
+		}
+		return err
+	}
+	if rename {
+		u.Username = *p.Username
+		u.UsernameChangedAt = now.Format(time.RFC3339)
+	}
+	if p.Country != nil {
+		u.Country = *p.Country
+	}
+	if p.Avatar != nil {
+		u.Avatar = *p.Avatar
+	}
+	if rezone {
+		u.Timezone = *p.Timezone
+		u.TimezoneChangedAt = now.Format(time.RFC3339)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package structs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileUpdateNormalize(t *testing.T) {
+	username, country, avatar := " Blaster ", "tur", "cat"
+	p := ProfileUpdate{Username: &username, Country: &country, Avatar: &avatar}
+	assert.Nil(t, p.Normalize())
+	assert.Equal(t, "Blaster", *p.Username)
+	assert.Equal(t, "TR", *p.Country)
+	assert.Equal(t, "cat", *p.Avatar)
+
+	// Omitted fields are left out
+	p = ProfileUpdate{Avatar: &avatar}
+	assert.Nil(t, p.Normalize())
+	assert.Nil(t, p.Username)
+	assert.Nil(t, p.Country)
+
+	country, avatar = "Turkey", "unicorn"
+	p = ProfileUpdate{Country: &country}
+	assert.Equal(t, ErrUnknownCountry, p.Normalize())
+	p = ProfileUpdate{Avatar: &avatar}
+	assert.Equal(t, ErrUnknownAvatar, p.Normalize())
+
+	timezone := "Mars/Olympus"
+	p = ProfileUpdate{Timezone: &timezone}
+	assert.Equal(t, ErrUnknownTimezone, p.Normalize())
+	timezone = "Europe/Istanbul"
+	assert.Nil(t, p.Normalize())
+}
+
+func TestCooledDown(t *testing.T) {
+	now := time.Date(2024, 1, 8, 12, 0, 0, 0, time.UTC)
+	assert.True(t, cooledDown("", 7, now))
+	assert.True(t, cooledDown("2024-01-01T12:00:00Z", 7, now))
+	assert.False(t, cooledDown("2024-01-01T12:00:01Z", 7, now))
+	assert.False(t, cooledDown("2024-01-08T00:00:00+03:00", 7, now))
+}
@@ -0,0 +1,97 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"oguzhanakan0/good-blast-api/config"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+var (
+	ErrLevelMismatch   = errors.New("Level does not match the user's level.")
+	ErrTooFast         = errors.New("Level is completed too fast.")
+	ErrInvalidResult   = errors.New("Level result is not valid.")
+	ErrAttemptFinished = errors.New("Level attempt is already finished.")
+)
+
+// Result of a completed level, reported by the client.
+type LevelResult struct {
+	AttemptID string `json:"attemptID"` // session token issued when the level is started
+	Level     int    `json:"level"`
+	Moves     int    `json:"moves"`
+	Stars     int    `json:"stars"`
+	Score     int    `json:"score"`
+}
+
+// Returns the coins earned by the result.
+func (r LevelResult) Coins() int {
+	return config.ProgressCoinReward + r.Stars*config.ProgressStarCoinReward
+}
+
+// Checks that the result belongs to the user's current attempt and is plausible.
+func (u *User) ValidateResult(r LevelResult, now time.Time) error {
+	if u.Attempt == nil || u.Attempt.ID != r.AttemptID {
+		return ErrAttemptFinished
+	}
+	if r.Level != u.Level || r.Level != u.Attempt.Level {
+		return ErrLevelMismatch
+	}
+	if r.Moves < 1 || r.Moves > config.LevelMaxMoves {
+		return fmt.Errorf("%w Moves must be between 1 and %d.", ErrInvalidResult, config.LevelMaxMoves)
+	}
+	if r.Stars < 1 || r.Stars > config.LevelMaxStars {
+		return fmt.Errorf("%w Stars must be between 1 and %d.", ErrInvalidResult, config.LevelMaxStars)
+	}
+	if r.Score < 0 {
+		return fmt.Errorf("%w Score cannot be negative.", ErrInvalidResult)
+	}
+	startedAt, err := time.Parse(time.RFC3339, u.Attempt.StartedAt)
+	if err != nil {
+		return ErrAttemptFinished
+	}
+	if now.Sub(startedAt) < config.LevelMinSeconds*time.Second {
+		return ErrTooFast
+	}
+	return nil
+}
+
+// Validates the result of the user's current attempt, ends the attempt and levels
+// the user up with the rewards earned by the result. Each attempt can only be
+// completed once, and the attempt is only ended together with the level up.
+func (u *User) CompleteLevel(db *dynamodb.DynamoDB, r LevelResult, now time.Time) error {
+	err := u.ValidateResult(r, now)
+	if err != nil {
+		return err
+	}
+	prevLives, prevRefilledAt := u.Lives, u.LivesRefilledAt
+	u.RegenerateLives(now)
+	if u.Lives < config.UserMaxLives {
+		u.Lives++
+	}
+	u.Attempt = nil
+	update := u.levelUpdate(r)
+	update.Condition += " AND attempt.id = :attemptID"
+	update.Values[":attemptID"] = &dynamodb.AttributeValue{S: aws.String(r.AttemptID)}
+	err = u.saveLives(db, prevLives, prevRefilledAt, update)
+	if err == ErrLivesChanged {
+		return ErrAttemptFinished
+	}
+	if err != nil {
+		return err
+	}
+	u.levelUp(r)
+	err = u.UpdateTournamentScore(db, now.Format(TournamentIDLayout), r)
+	if err != nil {
+		return err
+	}
+	// The level up is already saved, so a failure is only logged
+	err = u.UpdateTeamScore(db, r, now)
+	if err != nil {
+		log.Printf("Cannot update the team score of user %s: %s", u.ID, err)
+	}
+	return nil
+}
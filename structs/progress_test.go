@@ -0,0 +1,22 @@
+package structs
+
+import (
+	"errors"
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResult(t *testing.T) {
+	now := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	startedAt := now.Add(-time.Minute).Format(time.RFC3339)
+	u := User{Level: 7, Attempt: &LevelAttempt{ID: "a", Level: 7, StartedAt: startedAt}}
+
+	assert.Nil(t, u.ValidateResult(LevelResult{AttemptID: "a", Level: 7, Moves: 10, Stars: 2}, now))
+	assert.Equal(t, ErrAttemptFinished, u.ValidateResult(LevelResult{AttemptID: "b", Level: 7, Moves: 10, Stars: 2}, now))
+	assert.Equal(t, ErrLevelMismatch, u.ValidateResult(LevelResult{AttemptID: "a", Level: 8, Moves: 10, Stars: 2}, now))
+	assert.True(t, errors.Is(u.ValidateResult(LevelResult{AttemptID: "a", Level: 7, Moves: config.LevelMaxMoves + 1, Stars: 2}, now), ErrInvalidResult))
+	assert.Equal(t, ErrTooFast, u.ValidateResult(LevelResult{AttemptID: "a", Level: 7, Moves: 10, Stars: 2}, now.Add(-time.Minute)))
+}
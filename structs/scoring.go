@@ -0,0 +1,68 @@
+package structs
+
+import (
+	"errors"
+	"oguzhanakan0/good-blast-api/config"
+)
+
+const (
+	ScoringFlat          = "flat"
+	ScoringLevelWeighted = "level-weighted"
+	ScoringStars         = "stars"
+	ScoringStreak        = "streak"
+)
+
+// Decides how many tournament points a completed level is worth.
+type ScoringPolicy interface {
+	Points(result LevelResult, streak int) int
+}
+
+// Every level is worth the same.
+type FlatScoring struct{}
+
+func (FlatScoring) Points(result LevelResult, streak int) int {
+	return config.ProgressTournamentReward
+}
+
+// Harder levels are worth more: an extra point every config.ScoringLevelStep levels.
+type LevelWeightedScoring struct{}
+
+func (LevelWeightedScoring) Points(result LevelResult, streak int) int {
+	return config.ProgressTournamentReward * (1 + result.Level/config.ScoringLevelStep)
+}
+
+// Each star earned on the level is worth a point.
+type StarsScoring struct{}
+
+func (StarsScoring) Points(result LevelResult, streak int) int {
+	return config.ProgressTournamentReward * result.Stars
+}
+
+// Levels completed in a row without a failure multiply the points, up to
+// config.ScoringMaxStreakMultiplier.
+type StreakScoring struct{}
+
+func (StreakScoring) Points(result LevelResult, streak int) int {
+	multiplier := min(1+streak/config.ScoringStreakStep, config.ScoringMaxStreakMultiplier)
+	return config.ProgressTournamentReward * multiplier
+}
+
+var ScoringPolicies = map[string]ScoringPolicy{
+	ScoringFlat:          FlatScoring{},
+	ScoringLevelWeighted: LevelWeightedScoring{},
+	ScoringStars:         StarsScoring{},
+	ScoringStreak:        StreakScoring{},
+}
+
+// Returns the scoring policy with the given name. Tournaments without a policy are
+// scored flat.
+func GetScoringPolicy(name string) (ScoringPolicy, error) {
+	if name == "" {
+		return FlatScoring{}, nil
+	}
+	policy, ok := ScoringPolicies[name]
+	if !ok {
+		return nil, errors.New("Scoring policy does not exist.")
+	}
+	return policy, nil
+}
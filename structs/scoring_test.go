@@ -0,0 +1,45 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlatScoring(t *testing.T) {
+	policy := FlatScoring{}
+	assert.Equal(t, config.ProgressTournamentReward, policy.Points(LevelResult{Level: 1, Stars: 1}, 0))
+	assert.Equal(t, config.ProgressTournamentReward, policy.Points(LevelResult{Level: 90, Stars: 3}, 10))
+}
+
+func TestLevelWeightedScoring(t *testing.T) {
+	policy := LevelWeightedScoring{}
+	assert.Equal(t, config.ProgressTournamentReward, policy.Points(LevelResult{Level: config.ScoringLevelStep - 1}, 0))
+	assert.Equal(t, 2*config.ProgressTournamentReward, policy.Points(LevelResult{Level: config.ScoringLevelStep}, 0))
+	assert.Equal(t, 4*config.ProgressTournamentReward, policy.Points(LevelResult{Level: 3 * config.ScoringLevelStep}, 0))
+}
+
+func TestStarsScoring(t *testing.T) {
+	policy := StarsScoring{}
+	assert.Equal(t, config.ProgressTournamentReward, policy.Points(LevelResult{Stars: 1}, 0))
+	assert.Equal(t, 3*config.ProgressTournamentReward, policy.Points(LevelResult{Stars: 3}, 0))
+}
+
+func TestStreakScoring(t *testing.T) {
+	policy := StreakScoring{}
+	assert.Equal(t, config.ProgressTournamentReward, policy.Points(LevelResult{}, 0))
+	assert.Equal(t, 2*config.ProgressTournamentReward, policy.Points(LevelResult{}, config.ScoringStreakStep))
+	assert.Equal(t, config.ScoringMaxStreakMultiplier*config.ProgressTournamentReward, policy.Points(LevelResult{}, 1000))
+}
+
+func TestGetScoringPolicy(t *testing.T) {
+	policy, err := GetScoringPolicy("")
+	assert.Nil(t, err)
+	assert.Equal(t, FlatScoring{}, policy)
+	policy, err = GetScoringPolicy(ScoringStars)
+	assert.Nil(t, err)
+	assert.Equal(t, StarsScoring{}, policy)
+	_, err = GetScoringPolicy("unknown")
+	assert.NotNil(t, err)
+}
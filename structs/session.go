@@ -0,0 +1,132 @@
+package structs
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+)
+
+var ErrSessionRevoked = errors.New("Session is revoked or expired.")
+
+// A login session of a user. Tokens carry the session ID so that all tokens of
+// a session can be invalidated at once by revoking it. Sessions are keyed by
+// userID and ID, so that all sessions of a user can be listed.
+type Session struct {
+	ID        string `json:"id"`
+	UserID    string `json:"userID"`
+	Role      string `json:"role"` // role of the user at login
+	CreatedAt string `json:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt"` // unix seconds, same as the refresh token
+	Revoked   bool   `json:"revoked"`
+}
+
+func NewSession(userID string, role string, now time.Time, duration time.Duration) Session {
+	if role == "" {
+		role = RolePlayer
+	}
+	return Session{
+		ID:        (uuid.New()).String(),
+		UserID:    userID,
+		Role:      role,
+		CreatedAt: now.Format(time.RFC3339),
+		ExpiresAt: now.Add(duration).Unix(),
+	}
+}
+
+func (s *Session) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error) {
+	av, err := dynamodbattribute.MarshalMap(s)
+	if err != nil {
+		return nil, errors.New("Cannot marshal the session.")
+	}
+	out, err := db.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("session"),
+		Item:      av,
+	})
+	return out, err
+}
+
+func (s *Session) Fetch(db *dynamodb.DynamoDB) error {
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("session"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userID": {S: aws.String(s.UserID)},
+			"id":     {S: aws.String(s.ID)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if out.Item == nil {
+		return errors.New("Could not find session.")
+	}
+	return dynamodbattribute.UnmarshalMap(out.Item, s)
+}
+
+// Returns ErrSessionRevoked if the session cannot be used anymore.
+func (s *Session) Check(now time.Time) error {
+	if s.Revoked || now.Unix() >= s.ExpiresAt {
+		return ErrSessionRevoked
+	}
+	return nil
+}
+
+// Marks the session as revoked. Tokens of a revoked session are rejected.
+func (s *Session) Revoke(db *dynamodb.DynamoDB) error {
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("session"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"userID": {S: aws.String(s.UserID)},
+			"id":     {S: aws.String(s.ID)},
+		},
+		UpdateExpression: aws.String("SET revoked = :true"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":true": {BOOL: aws.Bool(true)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.Revoked = true
+	return nil
+}
+
+// Returns all sessions of a user, including revoked and expired ones.
+func FetchSessions(db *dynamodb.DynamoDB, userID string) ([]Session, error) {
+	sessions := []Session{}
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("session"),
+		KeyConditionExpression: aws.String("userID = :userID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":userID": {S: aws.String(userID)},
+		},
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, e := range out.Items {
+			var session Session
+			dynamodbattribute.UnmarshalMap(e, &session)
+			sessions = append(sessions, session)
+		}
+		return true
+	})
+	return sessions, err
+}
+
+// Revokes every session of a user that is not revoked yet.
+func RevokeSessions(db *dynamodb.DynamoDB, userID string) error {
+	sessions, err := FetchSessions(db, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if session.Revoked {
+			continue
+		}
+		if err := session.Revoke(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,648 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	TeamRoleOwner   = "owner"   // one per team, can do everything
+	TeamRoleOfficer = "officer" // can kick members and enter tournaments
+	TeamRoleMember  = "member"
+)
+
+var TeamRoles = []string{TeamRoleOwner, TeamRoleOfficer, TeamRoleMember}
+
+var (
+	ErrTeamNotFound    = errors.New("Team does not exist.")
+	ErrTeamFull        = errors.New("Team is full.")
+	ErrAlreadyInTeam   = errors.New("User is already in a team.")
+	ErrNotTeamMember   = errors.New("User is not a member of the team.")
+	ErrTeamForbidden   = errors.New("User is not allowed to do this in the team.")
+	ErrTeamChanged     = errors.New("Team has changed, try again.")
+	ErrTeamNameInvalid = fmt.Errorf("Team name must contain %d to %d letters, digits, spaces or %s", config.UsernameMinLength, config.TeamNameMaxLength, usernameSymbols)
+)
+
+type Team struct {
+	ID          string                           `json:"id"`
+	Name        string                           `json:"name"`
+	Members     map[string]TeamMember            `json:"members"`     // format: { userID: TeamMember }
+	Tournaments map[string]TeamTournamentDetails `json:"tournaments"` // format: { tournamentID: TeamTournamentDetails }
+	CreatedAt   string                           `json:"createdAt"`
+}
+
+type TeamMember struct {
+	Role     string `json:"role"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+type TeamTournamentDetails struct {
+	GroupID       int             `json:"groupID"`
+	Contributions map[string]int  `json:"contributions"` // format: { userID: points }
+	RewardsPaid   map[string]bool `json:"rewardsPaid"`   // format: { userID: true }, set when the member's share is paid
+}
+
+// Validates a team name and returns it in normalized form. Team names follow
+// the rules of usernames but do not need to be unique.
+func NormalizeTeamName(name string) (string, error) {
+	name = norm.NFC.String(strings.TrimSpace(name))
+	length := utf8.RuneCountInString(name)
+	if length < config.UsernameMinLength || length > config.TeamNameMaxLength || strings.Contains(name, "  ") {
+		return name, ErrTeamNameInvalid
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !strings.ContainsRune(usernameSymbols, r) {
+			return name, ErrTeamNameInvalid
+		}
+	}
+	if usernameBlocked(name) {
+		return name, errors.New("Team name is not allowed.")
+	}
+	return name, nil
+}
+
+// Returns true if a member with the actor role can kick or change the role of a
+// member with the target role. The owner manages everyone, officers manage members.
+func CanManageMember(actor string, target string) bool {
+	switch actor {
+	case TeamRoleOwner:
+		return target != TeamRoleOwner
+	case TeamRoleOfficer:
+		return target == TeamRoleMember
+	default:
+		return false
+	}
+}
+
+// Returns all teams in database.
+func FetchTeams(db *dynamodb.DynamoDB) ([]Team, error) {
+	var teams []Team
+	err := db.ScanPages(&dynamodb.ScanInput{TableName: aws.String("team")}, func(out *dynamodb.ScanOutput, last bool) bool {
+		for _, e := range out.Items {
+			var team Team
+			dynamodbattribute.UnmarshalMap(e, &team)
+			teams = append(teams, team)
+		}
+		return true
+	})
+	return teams, err
+}
+
+func (t *Team) Fetch(db *dynamodb.DynamoDB) error {
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("team"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(t.ID)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if out.Item == nil {
+		return ErrTeamNotFound
+	}
+	err = dynamodbattribute.UnmarshalMap(out.Item, &t)
+	if err != nil {
+		return errors.New("Cannot parse the team.")
+	}
+	if t.Tournaments == nil {
+		t.Tournaments = map[string]TeamTournamentDetails{}
+	}
+	return nil
+}
+
+// Returns the member who takes over the team when the owner leaves: the
+// earliest officer, or the earliest member if there are no officers.
+func (t *Team) successor(ownerID string) string {
+	var ids []string
+	for id := range t.Members {
+		if id != ownerID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		a, b := t.Members[ids[i]], t.Members[ids[j]]
+		if (a.Role == TeamRoleOfficer) != (b.Role == TeamRoleOfficer) {
+			return a.Role == TeamRoleOfficer
+		}
+		if a.JoinedAt != b.JoinedAt {
+			return a.JoinedAt < b.JoinedAt
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) == 0 {
+		return ""
+	}
+	return ids[0]
+}
+
+// Returns the update that sets or removes the team of a user.
+func userTeamUpdate(userID string, teamID string, join bool) *dynamodb.TransactWriteItem {
+	update := &dynamodb.Update{
+		TableName: aws.String("user"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(userID)},
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":teamID": {S: aws.String(teamID)},
+		},
+	}
+	if join {
+		update.UpdateExpression = aws.String("SET teamID = :teamID")
+		update.ConditionExpression = aws.String("attribute_exists(id) AND attribute_not_exists(teamID)")
+	} else {
+		update.UpdateExpression = aws.String("REMOVE teamID")
+		update.ConditionExpression = aws.String("teamID = :teamID")
+	}
+	return &dynamodb.TransactWriteItem{Update: update}
+}
+
+// Creates a team with the user as its owner. A user can be in one team at a time.
+func CreateTeam(db *dynamodb.DynamoDB, u *User, name string, now time.Time) (Team, error) {
+	name, err := NormalizeTeamName(name)
+	if err != nil {
+		return Team{}, err
+	}
+	createdAt := now.UTC().Format(time.RFC3339)
+	team := Team{
+		ID:          uuid.New().String(),
+		Name:        name,
+		Members:     map[string]TeamMember{u.ID: {Role: TeamRoleOwner, JoinedAt: createdAt}},
+		Tournaments: map[string]TeamTournamentDetails{},
+		CreatedAt:   createdAt,
+	}
+	av, err := dynamodbattribute.MarshalMap(team)
+	if err != nil {
+		return team, errors.New("Cannot marshal the team.")
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String("team"),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(id)"),
+				},
+			},
+			userTeamUpdate(u.ID, team.ID, true),
+		},
+	})
+	if err != nil {
+		if len(failedConditions(err)) > 0 {
+			return team, ErrAlreadyInTeam
+		}
+		return team, err
+	}
+	u.TeamID = team.ID
+	return team, nil
+}
+
+// Adds the user to the team as a member, unless the team is full.
+func (t *Team) Join(db *dynamodb.DynamoDB, u *User, now time.Time) error {
+	member := TeamMember{Role: TeamRoleMember, JoinedAt: now.UTC().Format(time.RFC3339)}
+	av, err := dynamodbattribute.MarshalMap(member)
+	if err != nil {
+		return errors.New("Cannot marshal the team member.")
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("team"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(t.ID)},
+					},
+					UpdateExpression:    aws.String("SET members.#uid = :member"),
+					ConditionExpression: aws.String("attribute_exists(id) AND size(members) < :max"),
+					ExpressionAttributeNames: map[string]*string{
+						"#uid": aws.String(u.ID),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":member": {M: av},
+						":max":    {N: aws.String(strconv.Itoa(config.TeamMaxSize))},
+					},
+				},
+			},
+			userTeamUpdate(u.ID, t.ID, true),
+		},
+	})
+	if err != nil {
+		for _, i := range failedConditions(err) {
+			if i == 1 {
+				return ErrAlreadyInTeam
+			}
+			return ErrTeamFull
+		}
+		return err
+	}
+	t.Members[u.ID] = member
+	u.TeamID = t.ID
+	return nil
+}
+
+// Removes a member from the team. If the owner leaves, the earliest officer or
+// member becomes the owner. The team is deleted when its last member leaves.
+func (t *Team) Leave(db *dynamodb.DynamoDB, userID string) error {
+	member, ok := t.Members[userID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(t.ID)},
+	}
+	names := map[string]*string{
+		"#uid":  aws.String(userID),
+		"#role": aws.String("role"),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":role": {S: aws.String(member.Role)},
+		":size": {N: aws.String(strconv.Itoa(len(t.Members)))},
+	}
+	var item *dynamodb.TransactWriteItem
+	successor := t.successor(userID)
+	if successor == "" {
+		item = &dynamodb.TransactWriteItem{
+			Delete: &dynamodb.Delete{
+				TableName:                 aws.String("team"),
+				Key:                       key,
+				ConditionExpression:       aws.String("members.#uid.#role = :role AND size(members) = :size"),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		}
+	} else {
+		expr := "REMOVE members.#uid"
+		if member.Role == TeamRoleOwner {
+			expr += " SET members.#successor.#role = :owner"
+			names["#successor"] = aws.String(successor)
+			values[":owner"] = &dynamodb.AttributeValue{S: aws.String(TeamRoleOwner)}
+		}
+		item = &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName:                 aws.String("team"),
+				Key:                       key,
+				UpdateExpression:          aws.String(expr),
+				ConditionExpression:       aws.String("members.#uid.#role = :role AND size(members) = :size"),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: values,
+			},
+		}
+	}
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{item, userTeamUpdate(userID, t.ID, false)},
+	})
+	if err != nil {
+		if len(failedConditions(err)) > 0 {
+			return ErrTeamChanged
+		}
+		return err
+	}
+	delete(t.Members, userID)
+	if member.Role == TeamRoleOwner && successor != "" {
+		m := t.Members[successor]
+		m.Role = TeamRoleOwner
+		t.Members[successor] = m
+	}
+	return nil
+}
+
+// Removes a member from the team on behalf of another member.
+func (t *Team) Kick(db *dynamodb.DynamoDB, actorID string, memberID string) error {
+	actor, ok := t.Members[actorID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	member, ok := t.Members[memberID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	if !CanManageMember(actor.Role, member.Role) {
+		return ErrTeamForbidden
+	}
+	return t.Leave(db, memberID)
+}
+
+// Changes the role of a member on behalf of the owner. Making another member the
+// owner transfers the ownership, and the previous owner becomes an officer.
+func (t *Team) SetMemberRole(db *dynamodb.DynamoDB, actorID string, memberID string, role string) error {
+	actor, ok := t.Members[actorID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	member, ok := t.Members[memberID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	if !slices.Contains(TeamRoles, role) {
+		return fmt.Errorf("Unknown team role: %s", role)
+	}
+	if actor.Role != TeamRoleOwner || !CanManageMember(actor.Role, member.Role) {
+		return ErrTeamForbidden
+	}
+	expr := "SET members.#member.#role = :role"
+	if role == TeamRoleOwner {
+		expr += ", members.#actor.#role = :officer"
+	}
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("team"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(t.ID)},
+		},
+		UpdateExpression:    aws.String(expr),
+		ConditionExpression: aws.String("members.#actor.#role = :owner AND attribute_exists(members.#member)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#actor":  aws.String(actorID),
+			"#member": aws.String(memberID),
+			"#role":   aws.String("role"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":role":    {S: aws.String(role)},
+			":owner":   {S: aws.String(TeamRoleOwner)},
+			":officer": {S: aws.String(TeamRoleOfficer)},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return ErrTeamChanged
+		}
+		return err
+	}
+	member.Role = role
+	t.Members[memberID] = member
+	if role == TeamRoleOwner {
+		actor.Role = TeamRoleOfficer
+		t.Members[actorID] = actor
+	}
+	return nil
+}
+
+// Enters the team into a team tournament on behalf of its owner or an officer.
+// Team tournaments are free to enter and teams are grouped against other teams.
+func (t *Team) EnterTournament(db *dynamodb.DynamoDB, tournament Tournament, actorID string) error {
+	actor, ok := t.Members[actorID]
+	if !ok {
+		return ErrNotTeamMember
+	}
+	if actor.Role != TeamRoleOwner && actor.Role != TeamRoleOfficer {
+		return ErrTeamForbidden
+	}
+	if !tournament.Team {
+		return errors.New("This is not a team tournament.")
+	} else if tournament.Completed {
+		return errors.New("This tournament has already been completed.")
+	} else if tournament.Cancelled {
+		return errors.New("This tournament has been cancelled.")
+	} else if _, alreadyIn := t.Tournaments[tournament.ID]; alreadyIn {
+		return errors.New("Team is already in the tournament.")
+	}
+	// Reserve the entry before seating, so that a team is seated only once
+	details := TeamTournamentDetails{Contributions: map[string]int{}, RewardsPaid: map[string]bool{}}
+	av, err := dynamodbattribute.MarshalMap(details)
+	if err != nil {
+		return errors.New("Cannot marshal the team tournament.")
+	}
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(t.ID)},
+	}
+	names := map[string]*string{
+		"#tid": aws.String(tournament.ID),
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String("team"),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET tournaments.#tid = :details"),
+		ConditionExpression:      aws.String("attribute_not_exists(tournaments.#tid)"),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":details": {M: av},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return errors.New("Team is already in the tournament.")
+		}
+		return err
+	}
+	// A reservation without a group is removed, so that the team can enter again
+	cancel := func() {
+		db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                aws.String("team"),
+			Key:                      key,
+			UpdateExpression:         aws.String("REMOVE tournaments.#tid"),
+			ConditionExpression:      aws.String("tournaments.#tid.groupID = :zero"),
+			ExpressionAttributeNames: names,
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":zero": {N: aws.String("0")},
+			},
+		})
+	}
+	group, err := tournament.Seat(db, UserTournamentRecord{UserID: t.ID, Score: 0}, "", config.TeamGroupMaxLength)
+	if err != nil {
+		cancel()
+		return err
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                aws.String("team"),
+		Key:                      key,
+		UpdateExpression:         aws.String("SET tournaments.#tid.groupID = :groupID"),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":groupID": {N: aws.String(strconv.Itoa(group.GroupID))},
+		},
+	})
+	if err != nil {
+		if group.RemoveRecord(db, t.ID) == nil {
+			cancel()
+		}
+		return err
+	}
+	details.GroupID = group.GroupID
+	t.Tournaments[tournament.ID] = details
+	return nil
+}
+
+// Adds the points earned by the result to the score of the user's team in the
+// team tournament of the day, and records the user's contribution.
+func (u *User) UpdateTeamScore(db *dynamodb.DynamoDB, result LevelResult, now time.Time) error {
+	if u.TeamID == "" {
+		return nil
+	}
+	team := Team{ID: u.TeamID}
+	err := team.Fetch(db)
+	if err != nil {
+		return err
+	}
+	tournamentID := TeamTournamentPrefix + now.Format(TournamentIDLayout)
+	details, ok := team.Tournaments[tournamentID]
+	if !ok || details.GroupID == 0 {
+		return nil
+	}
+	t := Tournament{ID: tournamentID}
+	err = t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	if !t.IsActive(now) {
+		return nil
+	}
+	policy, err := GetScoringPolicy(t.Scoring)
+	if err != nil {
+		return err
+	}
+	points := policy.Points(result, u.Streak)
+	group := Group{TournamentID: tournamentID, GroupID: details.GroupID}
+	err = group.Fetch(db)
+	if err != nil {
+		return err
+	}
+	err = group.UpdateRecordScore(db, team.ID, points)
+	if err != nil {
+		return err
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("team"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(team.ID)},
+		},
+		UpdateExpression: aws.String("SET tournaments.#tid.contributions.#uid = if_not_exists(tournaments.#tid.contributions.#uid, :zero) + :points"),
+		ExpressionAttributeNames: map[string]*string{
+			"#tid": aws.String(tournamentID),
+			"#uid": aws.String(u.ID),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":zero":   {N: aws.String("0")},
+			":points": {N: aws.String(strconv.Itoa(points))},
+		},
+	})
+	return err
+}
+
+// Splits the coins of a team reward evenly among the members who contributed
+// points. The remainder goes to the highest contributors, one coin each.
+func SplitTeamReward(coins int, contributions map[string]int) map[string]int {
+	var ids []string
+	for id, points := range contributions {
+		if points > 0 {
+			ids = append(ids, id)
+		}
+	}
+	shares := map[string]int{}
+	if len(ids) == 0 || coins <= 0 {
+		return shares
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if contributions[ids[i]] != contributions[ids[j]] {
+			return contributions[ids[i]] > contributions[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	for i, id := range ids {
+		shares[id] = coins / len(ids)
+		if i < coins%len(ids) {
+			shares[id]++
+		}
+	}
+	return shares
+}
+
+// Pays the coins each team earned by its rank in its group to the members who
+// contributed. Every share is paid once, so a failed run can be repeated.
+func (t *Tournament) payTeamRewards(db *dynamodb.DynamoDB, groups []Group) error {
+	for _, group := range groups {
+		for rank, record := range group.Ranking() {
+			reward := RankReward(rank)
+			if reward.Coins == 0 {
+				continue
+			}
+			team := Team{ID: record.UserID}
+			err := team.Fetch(db)
+			if err == ErrTeamNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			details := team.Tournaments[t.ID]
+			for userID, coins := range SplitTeamReward(reward.Coins, details.Contributions) {
+				if details.RewardsPaid[userID] {
+					continue
+				}
+				err = payTeamReward(db, team.ID, t.ID, userID, coins)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Gives a member their share of a team reward and records it in the ledger.
+func payTeamReward(db *dynamodb.DynamoDB, teamID string, tournamentID string, userID string, coins int) error {
+	entry := NewLedgerEntry(userID, LedgerReasonTeamReward, coins, tournamentID)
+	av, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return errors.New("Cannot marshal the ledger entry.")
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("team"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(teamID)},
+					},
+					UpdateExpression:    aws.String("SET tournaments.#tid.rewardsPaid.#uid = :paid"),
+					ConditionExpression: aws.String("attribute_not_exists(tournaments.#tid.rewardsPaid.#uid)"),
+					ExpressionAttributeNames: map[string]*string{
+						"#tid": aws.String(tournamentID),
+						"#uid": aws.String(userID),
+					},
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":paid": {BOOL: aws.Bool(true)},
+					},
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(userID)},
+					},
+					UpdateExpression:    aws.String("SET coins = coins + :amount"),
+					ConditionExpression: aws.String("attribute_exists(id)"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":amount": {N: aws.String(strconv.Itoa(coins))},
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName: aws.String("ledger"),
+					Item:      av,
+				},
+			},
+		},
+	})
+	// Already paid, or the member's account has been deleted
+	if len(failedConditions(err)) > 0 {
+		return nil
+	}
+	return err
+}
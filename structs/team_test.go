@@ -0,0 +1,51 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanManageMember(t *testing.T) {
+	assert.True(t, CanManageMember(TeamRoleOwner, TeamRoleOfficer))
+	assert.True(t, CanManageMember(TeamRoleOwner, TeamRoleMember))
+	assert.False(t, CanManageMember(TeamRoleOwner, TeamRoleOwner))
+	assert.True(t, CanManageMember(TeamRoleOfficer, TeamRoleMember))
+	assert.False(t, CanManageMember(TeamRoleOfficer, TeamRoleOfficer))
+	assert.False(t, CanManageMember(TeamRoleOfficer, TeamRoleOwner))
+	assert.False(t, CanManageMember(TeamRoleMember, TeamRoleMember))
+}
+
+func TestSplitTeamReward(t *testing.T) {
+	shares := SplitTeamReward(1000, map[string]int{"a": 5, "b": 20, "c": 0, "d": 5})
+	assert.Equal(t, map[string]int{"a": 333, "b": 334, "d": 333}, shares)
+
+	shares = SplitTeamReward(1000, map[string]int{"a": 0})
+	assert.Empty(t, shares)
+}
+
+func TestSuccessor(t *testing.T) {
+	team := Team{Members: map[string]TeamMember{
+		"owner": {Role: TeamRoleOwner, JoinedAt: "2000-01-01T00:00:00Z"},
+		"early": {Role: TeamRoleMember, JoinedAt: "2000-01-02T00:00:00Z"},
+		"late":  {Role: TeamRoleOfficer, JoinedAt: "2000-01-03T00:00:00Z"},
+	}}
+	assert.Equal(t, "late", team.successor("owner"))
+
+	delete(team.Members, "late")
+	assert.Equal(t, "early", team.successor("owner"))
+
+	delete(team.Members, "early")
+	assert.Equal(t, "", team.successor("owner"))
+}
+
+func TestNormalizeTeamName(t *testing.T) {
+	name, err := NormalizeTeamName("  Blast Squad ")
+	assert.Nil(t, err)
+	assert.Equal(t, "Blast Squad", name)
+
+	_, err = NormalizeTeamName("ab")
+	assert.Equal(t, ErrTeamNameInvalid, err)
+	_, err = NormalizeTeamName("Blast!")
+	assert.Equal(t, ErrTeamNameInvalid, err)
+}
@@ -1,19 +1,84 @@
 package structs
 
 import (
+	"context"
 	"errors"
 	"oguzhanakan0/good-blast-api/config"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
+// Tournaments are identified by the day they are held on.
+const TournamentIDLayout = "2006-01-02"
+
+// Team tournaments are identified by this prefix and the day they are held on,
+// so that they can be held on the same day as the daily tournament.
+const TeamTournamentPrefix = "team-"
+
 type Tournament struct {
 	ID           string              `json:"id"`
-	Leaderboards map[string][]string `json:"leaderboards"` // format: { countryCode: Leaderboard }
-	Completed    bool                `json:"completed"`    // true if the tournament has ended and results are calculated
+	Leaderboards map[string][]string `json:"leaderboards"`          // format: { countryCode: Leaderboard }
+	Completed    bool                `json:"completed"`             // true if the tournament has ended and results are calculated
+	Cancelled    bool                `json:"cancelled"`             // true if the tournament is cancelled and entry fees are refunded
+	Start        string              `json:"start,omitempty"`       // RFC3339, defaults to the midnight of the tournament day
+	End          string              `json:"end,omitempty"`         // RFC3339, defaults to the midnight after the tournament day
+	AutoRewards  bool                `json:"autoRewards"`           // true if rewards are fixed for every player at finalization
+	ClaimWindow  int                 `json:"claimWindow"`           // hours to claim rewards after the tournament ends, defaults to config.RewardClaimWindowHours
+	Scoring      string              `json:"scoring"`               // name of the scoring policy, flat if empty
+	Team         bool                `json:"team"`                  // true if teams compete instead of players, see TeamTournamentPrefix
+	CompletedAt  string              `json:"completedAt,omitempty"` // RFC3339, when the results were first calculated
+	LastGroups   map[string]int      `json:"lastGroups,omitempty"`  // format: { league: groupID }, the group new players of the league are seated in
+}
+
+// Returns all tournaments in database.
+func FetchTournaments(db *dynamodb.DynamoDB) ([]Tournament, error) {
+	var tournaments []Tournament
+	err := db.ScanPages(&dynamodb.ScanInput{TableName: aws.String("tournament")}, func(out *dynamodb.ScanOutput, last bool) bool {
+		for _, e := range out.Items {
+			var tournament Tournament
+			dynamodbattribute.UnmarshalMap(e, &tournament)
+			tournaments = append(tournaments, tournament)
+		}
+		return true
+	})
+	return tournaments, err
+}
+
+// Returns the daily and team tournaments of the given number of days up to and
+// including the day of now, oldest first. Days without tournaments are skipped.
+func FetchRecentTournaments(db *dynamodb.DynamoDB, now time.Time, days int) ([]Tournament, error) {
+	var tournaments []Tournament
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(TournamentIDLayout)
+		for _, id := range []string{day, TeamTournamentPrefix + day} {
+			out, err := db.GetItem(&dynamodb.GetItemInput{
+				TableName: aws.String("tournament"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"id": {S: aws.String(id)},
+				},
+			})
+			if err != nil {
+				return tournaments, err
+			}
+			if out.Item == nil {
+				continue
+			}
+			var t Tournament
+			if err := dynamodbattribute.UnmarshalMap(out.Item, &t); err != nil {
+				return tournaments, err
+			}
+			tournaments = append(tournaments, t)
+		}
+	}
+	return tournaments, nil
 }
 
 func (t *Tournament) Fetch(db *dynamodb.DynamoDB) error {
@@ -36,9 +101,31 @@ func (t *Tournament) Fetch(db *dynamodb.DynamoDB) error {
 	return nil
 }
 
+// Returns every group of the tournament.
 func (t *Tournament) FetchGroups(db *dynamodb.DynamoDB) ([]Group, error) {
+	var groups []Group
+	err := db.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("group"),
+		KeyConditionExpression: aws.String("tournamentID = :tournamentID"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tournamentID": {S: aws.String(t.ID)},
+		},
+	}, func(out *dynamodb.QueryOutput, last bool) bool {
+		for _, e := range out.Items {
+			var group Group
+			dynamodbattribute.UnmarshalMap(e, &group)
+			groups = append(groups, group)
+		}
+		return true
+	})
+	return groups, err
+}
+
+func (t *Tournament) FetchLastGroup(db *dynamodb.DynamoDB) (Group, error) {
 	out, err := db.Query(&dynamodb.QueryInput{
-		TableName: aws.String("group"),
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(1),
+		TableName:        aws.String("group"),
 		KeyConditions: map[string]*dynamodb.Condition{
 			"tournamentID": {
 				ComparisonOperator: aws.String("EQ"),
@@ -51,59 +138,173 @@ func (t *Tournament) FetchGroups(db *dynamodb.DynamoDB) ([]Group, error) {
 		},
 	})
 
+	var group Group
 	if err != nil {
-		panic(err)
+		return group, err
 	}
 
-	var group []Group
-
 	if len(out.Items) == 0 {
 		return group, nil
 	}
 
-	var groups []Group
-	for _, e := range out.Items {
-		var group Group
-		dynamodbattribute.UnmarshalMap(e, &group)
-		groups = append(groups, group)
-	}
+	err = dynamodbattribute.UnmarshalMap(out.Items[0], &group)
+	return group, err
+}
 
-	return groups, nil
+// Returns the group of the league with the highest ID in the tournament, or an
+// empty group if the league has no groups yet. The ID is kept in the tournament,
+// see setLastLeagueGroup.
+func (t *Tournament) FetchLastLeagueGroup(db *dynamodb.DynamoDB, league string) (Group, error) {
+	var group Group
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("tournament"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(t.ID)},
+		},
+		ProjectionExpression: aws.String("lastGroups.#league"),
+		ExpressionAttributeNames: map[string]*string{
+			"#league": aws.String(league),
+		},
+	})
+	if err != nil {
+		return group, err
+	}
+	var last Tournament
+	err = dynamodbattribute.UnmarshalMap(out.Item, &last)
+	if err != nil {
+		return group, err
+	}
+	groupID, ok := last.LastGroups[league]
+	if !ok {
+		return group, nil
+	}
+	group = Group{TournamentID: t.ID, GroupID: groupID}
+	return group, group.Fetch(db)
 }
 
-func (t *Tournament) FetchLastGroup(db *dynamodb.DynamoDB) (Group, error) {
-	out, err := db.Query(&dynamodb.QueryInput{
-		ScanIndexForward: aws.Bool(false),
-		Limit:            aws.Int64(1),
-		TableName:        aws.String("group"),
-		KeyConditions: map[string]*dynamodb.Condition{
-			"tournamentID": {
-				ComparisonOperator: aws.String("EQ"),
-				AttributeValueList: []*dynamodb.AttributeValue{
-					{
-						S: aws.String(t.ID),
-					},
-				},
-			},
+// Records the group as the last group of the league in the tournament, unless a
+// group with a higher ID is recorded already.
+func (t *Tournament) setLastLeagueGroup(db *dynamodb.DynamoDB, league string, groupID int) error {
+	key := map[string]*dynamodb.AttributeValue{
+		"id": {S: aws.String(t.ID)},
+	}
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String("tournament"),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET lastGroups = :empty"),
+		ConditionExpression: aws.String("attribute_exists(id) AND attribute_not_exists(lastGroups)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":empty": {M: map[string]*dynamodb.AttributeValue{}},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException) {
+		return err
+	}
+	_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String("tournament"),
+		Key:                 key,
+		UpdateExpression:    aws.String("SET lastGroups.#league = :groupID"),
+		ConditionExpression: aws.String("attribute_not_exists(lastGroups.#league) OR lastGroups.#league < :groupID"),
+		ExpressionAttributeNames: map[string]*string{
+			"#league": aws.String(league),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":groupID": {N: aws.String(strconv.Itoa(groupID))},
 		},
 	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
+	return err
+}
 
-	if err != nil || len(out.Items) > 1 {
-		panic(err)
+// Inserts the tournament unless a tournament with the same ID already exists.
+// Returns true if the tournament is created.
+func (t *Tournament) Create(db *dynamodb.DynamoDB) (bool, error) {
+	av, err := dynamodbattribute.MarshalMap(t)
+	if err != nil {
+		return false, errors.New("Cannot marshal the tournament.")
+	}
+	_, err = db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("tournament"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return false, nil
+		}
+		return false, err
 	}
+	return true, nil
+}
 
-	var group Group
+// Returns the time the tournament ends, which is the midnight after the tournament day
+// unless an end time is set.
+func (t *Tournament) EndsAt() (time.Time, error) {
+	if t.End != "" {
+		return time.Parse(time.RFC3339, t.End)
+	}
+	day, err := t.day()
+	if err != nil {
+		return day, err
+	}
+	return day.AddDate(0, 0, 1), nil
+}
 
-	if len(out.Items) == 0 {
-		return group, nil
+// Returns the time the tournament starts, which is the midnight of the tournament
+// day unless a start time is set.
+func (t *Tournament) StartsAt() (time.Time, error) {
+	if t.Start != "" {
+		return time.Parse(time.RFC3339, t.Start)
 	}
+	return t.day()
+}
 
-	err = dynamodbattribute.UnmarshalMap(out.Items[0], &group)
+// Returns the midnight of the day the tournament is held on.
+func (t *Tournament) day() (time.Time, error) {
+	day, err := time.Parse(TournamentIDLayout, strings.TrimPrefix(t.ID, TeamTournamentPrefix))
 	if err != nil {
-		panic(err)
+		return day, errors.New("Tournament ID is not a date.")
 	}
+	return day, nil
+}
+
+// Returns true if the tournament accepts scores at the given time.
+func (t *Tournament) IsActive(now time.Time) bool {
+	if t.Completed || t.Cancelled {
+		return false
+	}
+	startsAt, err := t.StartsAt()
+	if err != nil || now.Before(startsAt) {
+		return false
+	}
+	endsAt, err := t.EndsAt()
+	return err == nil && now.Before(endsAt)
+}
 
-	return group, nil
+// Returns the time after which rewards of the tournament cannot be claimed anymore.
+// The claim window starts when the results are calculated, or when the tournament
+// ends if it has not been finalized yet.
+func (t *Tournament) ClaimExpiresAt() (time.Time, error) {
+	endsAt, err := t.EndsAt()
+	if err != nil {
+		return endsAt, err
+	}
+	if t.CompletedAt != "" {
+		completedAt, err := time.Parse(time.RFC3339, t.CompletedAt)
+		if err != nil {
+			return completedAt, err
+		}
+		if completedAt.After(endsAt) {
+			endsAt = completedAt
+		}
+	}
+	window := t.ClaimWindow
+	if window == 0 {
+		window = config.RewardClaimWindowHours
+	}
+	return endsAt.Add(time.Duration(window) * time.Hour), nil
 }
 
 func (t *Tournament) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error) {
@@ -118,13 +319,18 @@ func (t *Tournament) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error)
 	return out, err
 }
 
-func (t *Tournament) UpdateLeaderboards(db *dynamodb.DynamoDB) error {
+// Calculates the leaderboards of the tournament from its groups without saving them.
+func (t *Tournament) ComputeLeaderboards(db *dynamodb.DynamoDB) (map[string][]string, error) {
 	// Fetch all groups for this tournament
 	groups, err := t.FetchGroups(db)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return ComputeLeaderboards(groups), nil
+}
 
+// Calculates global and country leaderboards from the players of the given groups.
+func ComputeLeaderboards(groups []Group) map[string][]string {
 	// Merge users into one map
 	var players []UserTournamentRecord
 	for _, group := range groups {
@@ -134,7 +340,7 @@ func (t *Tournament) UpdateLeaderboards(db *dynamodb.DynamoDB) error {
 	}
 
 	// Calculate leaderboards
-	sort.Slice(players, func(i, j int) bool { return players[i].Score > players[j].Score })
+	sort.SliceStable(players, func(i, j int) bool { return players[i].Score > players[j].Score })
 	countries := map[string]bool{}
 	leaderboards := map[string][]string{}
 	leaderboards["ALL"] = []string{}
@@ -145,6 +351,10 @@ func (t *Tournament) UpdateLeaderboards(db *dynamodb.DynamoDB) error {
 		}
 	}
 	for country := range countries {
+		// Teams have no country
+		if country == "" {
+			continue
+		}
 		var board []string
 		for _, p := range players {
 			if p.Country == country {
@@ -156,21 +366,210 @@ func (t *Tournament) UpdateLeaderboards(db *dynamodb.DynamoDB) error {
 		}
 		leaderboards[country] = board
 	}
+	return leaderboards
+}
+
+// Calculates the results of the tournament and marks it completed. Nothing more is
+// written once ctx is cancelled, and the tournament is only marked completed if the
+// lease is still held.
+func (t *Tournament) updateLeaderboards(ctx context.Context, db *dynamodb.DynamoDB, lease *Lease) error {
+	if t.Cancelled {
+		return errors.New("Cannot calculate leaderboards of a cancelled tournament.")
+	}
+	groups, err := t.FetchGroups(db)
+	if err != nil {
+		return err
+	}
+	// Results are applied before the tournament is marked completed, so that a
+	// failed run is retried by the next finalization
+	err = t.applyResults(ctx, db, groups)
+	if err != nil {
+		return err
+	}
+	return t.saveLeaderboards(ctx, db, ComputeLeaderboards(groups), lease)
+}
+
+// Distributes the rewards, moves players between leagues and stores every
+// player's results. Stops with ErrLeaseHeld once ctx is cancelled.
+func (t *Tournament) applyResults(ctx context.Context, db *dynamodb.DynamoDB, groups []Group) error {
+	steps := []func(*dynamodb.DynamoDB, []Group) error{t.distributeRewards, t.moveLeagues, t.storeResults}
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return ErrLeaseHeld
+		}
+		err := step(db, groups)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Fixes the reward of every player according to their rank in their group if
+// the tournament has automatic rewards. Team rewards are always paid out to the
+// members at finalization.
+func (t *Tournament) distributeRewards(db *dynamodb.DynamoDB, groups []Group) error {
+	if t.Team {
+		return t.payTeamRewards(db, groups)
+	}
+	if !t.AutoRewards {
+		return nil
+	}
+	for _, group := range groups {
+		for rank, p := range group.Ranking() {
+			err := setFixedReward(db, p.UserID, t.ID, rank+1, RankReward(rank))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Stores the leaderboards and marks the tournament completed. The tournament is only
+// updated while the lease is held by its owner, so that a job that has lost the
+// lease cannot overwrite the results of the next one.
+func (t *Tournament) saveLeaderboards(ctx context.Context, db *dynamodb.DynamoDB, leaderboards map[string][]string, lease *Lease) error {
+	if ctx.Err() != nil {
+		return ErrLeaseHeld
+	}
 	av, _ := dynamodbattribute.MarshalMap(leaderboards)
-	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+	now := time.Now().UTC().Format(time.RFC3339)
+	update := &dynamodb.Update{
 		TableName: aws.String("tournament"),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {S: aws.String(t.ID)},
 		},
-		UpdateExpression: aws.String("SET leaderboards = :leaderboards, completed = :completed"),
+		// The claim window starts at the first finalization, a recalculation keeps it
+		UpdateExpression: aws.String("SET leaderboards = :leaderboards, completed = :completed, completedAt = if_not_exists(completedAt, :now)"),
+		// Tournament might have been cancelled while the leaderboards were being calculated
+		ConditionExpression: aws.String("attribute_not_exists(cancelled) OR cancelled = :false"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
 			":leaderboards": {M: av},
 			":completed":    {BOOL: aws.Bool(true)},
+			":now":          {S: aws.String(now)},
+			":false":        {BOOL: aws.Bool(false)},
 		},
+	}
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{{Update: update}, lease.conditionCheck()},
 	})
+	if slices.Contains(failedConditions(err), 1) {
+		return ErrLeaseHeld
+	}
 	if err != nil {
-		panic(err)
+		return err
+	}
+	t.Leaderboards = leaderboards
+	t.Completed = true
+	if t.CompletedAt == "" {
+		t.CompletedAt = now
+	}
+	return nil
+}
+
+// Calculates the results of the tournament while holding its finalization lease,
+// so that concurrent jobs never finalize the same tournament twice.
+func (t *Tournament) Finalize(db *dynamodb.DynamoDB, owner string) error {
+	return t.withFinalizeLease(db, owner, func(ctx context.Context, lease *Lease) error {
+		if t.Completed {
+			return nil
+		}
+		return t.updateLeaderboards(ctx, db, lease)
+	})
+}
+
+// Recalculates the results of the tournament even if it is already completed, and
+// returns the leaderboard positions that changed. Users' reward claims are kept as is.
+func (t *Tournament) Refinalize(db *dynamodb.DynamoDB, owner string) ([]LeaderboardChange, error) {
+	var changes []LeaderboardChange
+	err := t.withFinalizeLease(db, owner, func(ctx context.Context, lease *Lease) error {
+		if t.Cancelled {
+			return errors.New("Cannot calculate leaderboards of a cancelled tournament.")
+		}
+		groups, err := t.FetchGroups(db)
+		if err != nil {
+			return err
+		}
+		err = t.applyResults(ctx, db, groups)
+		if err != nil {
+			return err
+		}
+		leaderboards := ComputeLeaderboards(groups)
+		changes = DiffLeaderboards(t.Leaderboards, leaderboards)
+		return t.saveLeaderboards(ctx, db, leaderboards, lease)
+	})
+	return changes, err
+}
+
+// Runs fn while holding the finalization lease of the tournament. The tournament is
+// fetched again after the lease is acquired, since another job might have changed it.
+// The context passed to fn is cancelled if the lease is lost.
+func (t *Tournament) withFinalizeLease(db *dynamodb.DynamoDB, owner string, fn func(context.Context, *Lease) error) error {
+	lease := Lease{Name: "finalize#" + t.ID, Owner: owner}
+	err := lease.Acquire(db)
+	if err != nil {
+		return err
+	}
+	ctx, stop := lease.KeepAlive(db)
+	defer lease.Release(db)
+	defer stop()
+
+	err = t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	return fn(ctx, &lease)
+}
+
+// Marks the tournament as cancelled and refunds the entry fee of every participant.
+// It is safe to call again on an already cancelled tournament, e.g. to resume refunds
+// after a failure, since each participant is refunded at most once.
+func (t *Tournament) Cancel(db *dynamodb.DynamoDB) error {
+	if t.Completed {
+		return errors.New("Cannot cancel a completed tournament.")
+	}
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("tournament"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"id": {S: aws.String(t.ID)},
+		},
+		UpdateExpression:    aws.String("SET cancelled = :cancelled"),
+		ConditionExpression: aws.String("attribute_exists(id) AND (attribute_not_exists(completed) OR completed = :false)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":cancelled": {BOOL: aws.Bool(true)},
+			":false":     {BOOL: aws.Bool(false)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	t.Cancelled = true
+
+	// Refund every participant. Team tournaments are free to enter.
+	if t.Team {
+		return nil
+	}
+	groups, err := t.FetchGroups(db)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		for _, p := range group.Players {
+			u := User{ID: p.UserID}
+			err := u.Fetch(db)
+			if err != nil {
+				return err
+			}
+			// Players who were seated but have not paid are not in the tournament
+			if _, ok := u.Tournaments[t.ID]; !ok {
+				continue
+			}
+			err = u.RefundTournament(db, t.ID)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	_ = out
 	return nil
 }
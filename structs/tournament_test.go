@@ -0,0 +1,36 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimExpiresAt(t *testing.T) {
+	to := Tournament{ID: "2000-01-01"}
+	expiresAt, err := to.ClaimExpiresAt()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2000, 1, 2, config.RewardClaimWindowHours, 0, 0, 0, time.UTC), expiresAt)
+
+	to.ClaimWindow = 2
+	expiresAt, err = to.ClaimExpiresAt()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2000, 1, 2, 2, 0, 0, 0, time.UTC), expiresAt)
+
+	to.CompletedAt = "2000-01-03T10:00:00Z"
+	expiresAt, err = to.ClaimExpiresAt()
+	assert.Nil(t, err)
+	assert.Equal(t, time.Date(2000, 1, 3, 12, 0, 0, 0, time.UTC), expiresAt)
+}
+
+func TestIsActive(t *testing.T) {
+	to := Tournament{ID: TeamTournamentPrefix + "2000-01-01"}
+	assert.False(t, to.IsActive(time.Date(1999, 12, 31, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, to.IsActive(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)))
+	assert.False(t, to.IsActive(time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC)))
+
+	to.Completed = true
+	assert.False(t, to.IsActive(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)))
+}
@@ -3,28 +3,74 @@ package structs
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"strconv"
 	"time"
 
 	"oguzhanakan0/good-blast-api/config"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
+const (
+	RolePlayer  = "player"
+	RoleSupport = "support" // can read every user, group and tournament
+	RoleAdmin   = "admin"   // can also act on behalf of users and manage tournaments
+)
+
+var Roles = []string{RolePlayer, RoleSupport, RoleAdmin}
+
+var (
+	ErrRewardClaimed    = errors.New("Reward is already claimed before.")
+	ErrRewardExpired    = errors.New("Reward can no longer be claimed.")
+	ErrEntryRejected    = errors.New("User is already in the tournament or cannot pay the entry cost.")
+	ErrTournamentClosed = errors.New("Tournament has been cancelled or completed.")
+)
+
 type User struct {
-	ID          string                           `json:"id"`
-	Username    string                           `json:"username"`
-	Level       int                              `json:"gameLevel"`
-	Coins       int                              `json:"coins"`
-	Tournaments map[string]UserTournamentDetails `json:"tournaments"`
-	Country     string                           `json:"country"`
+	ID                string                           `json:"id"`
+	Username          string                           `json:"username"`
+	UsernameChangedAt string                           `json:"usernameChangedAt,omitempty"` // RFC3339, set when the user renames
+	Level             int                              `json:"gameLevel"`
+	Coins             int                              `json:"coins"`
+	Tournaments       map[string]UserTournamentDetails `json:"tournaments"`
+	Country           string                           `json:"country"`
+	Avatar            string                           `json:"avatar,omitempty"` // one of config.Avatars, the default avatar if empty
+	Inventory         map[string]int                   `json:"inventory"`        // format: { itemID: quantity }
+	Lives             int                              `json:"lives"`
+	LivesRefilledAt   string                           `json:"livesRefilledAt"`      // RFC3339, lives regenerate from this time on
+	Attempt           *LevelAttempt                    `json:"attempt"`              // level the user is playing, if any
+	Streak            int                              `json:"streak"`               // levels completed in a row without a failure
+	Role              string                           `json:"role,omitempty"`       // RolePlayer if empty
+	Identities        []string                         `json:"identities"`           // IDs of the linked identities
+	FriendCode        string                           `json:"friendCode,omitempty"` // created on first use
+	MergedInto        string                           `json:"mergedInto,omitempty"` // set if the account was merged into another user
+	TeamID            string                           `json:"teamID,omitempty"`     // set while the user is in a team
+	League            string                           `json:"league,omitempty"`     // one of config.Leagues, the lowest league if empty
+	LeagueHistory     []LeagueChange                   `json:"leagueHistory,omitempty"`
+	Timezone          string                           `json:"timezone,omitempty"`          // IANA name, UTC if empty
+	TimezoneChangedAt string                           `json:"timezoneChangedAt,omitempty"` // RFC3339, set when the user changes timezone
+	DailyBonus        *DailyBonus                      `json:"dailyBonus,omitempty"`
+	Stats             map[string]int                   `json:"stats,omitempty"`    // format: { metric: count }, counters of achievement metrics
+	Unlocked          map[string]string                `json:"unlocked,omitempty"` // format: { achievementID: unlockedAt }
 }
 
 type UserTournamentDetails struct {
-	GroupID       int  `json:"groupID"`
-	RewardClaimed bool `json:"rewardClaimed"`
+	GroupID       int               `json:"groupID"`
+	RewardClaimed bool              `json:"rewardClaimed"`
+	Refunded      bool              `json:"refunded"`
+	PaidWith      string            `json:"paidWith,omitempty"`     // PaymentCoins if empty
+	GroupRank     int               `json:"groupRank,omitempty"`    // one-based, set when the reward is fixed
+	Reward        int               `json:"reward"`                 // coins to claim, set when the reward is fixed
+	RewardItems   map[string]int    `json:"rewardItems,omitempty"`  // items to claim, set when the reward is fixed
+	RewardFixed   bool              `json:"rewardFixed"`            // true if the reward is fixed at finalization
+	League        string            `json:"league,omitempty"`       // league the user played in
+	LeagueResult  string            `json:"leagueResult,omitempty"` // LeaguePromoted or LeagueRelegated, set at finalization
+	Result        *TournamentResult `json:"result,omitempty"`       // set at finalization
 }
 
 type UserTournamentRecord struct {
@@ -33,6 +79,114 @@ type UserTournamentRecord struct {
 	Country string `json:"country"`
 }
 
+// A reward fixed at the finalization of a tournament.
+type UserReward struct {
+	TournamentID string         `json:"tournamentID"`
+	GroupRank    int            `json:"groupRank"`
+	Amount       int            `json:"amount"`
+	Items        map[string]int `json:"items,omitempty"`
+	Claimed      bool           `json:"claimed"`
+	ExpiresAt    string         `json:"expiresAt,omitempty"`
+}
+
+// Returns the user's fixed rewards, latest tournament first.
+func (u *User) Rewards() []UserReward {
+	rewards := []UserReward{}
+	for tournamentID, details := range u.Tournaments {
+		if !details.RewardFixed || (details.Reward == 0 && len(details.RewardItems) == 0) {
+			continue
+		}
+		rewards = append(rewards, UserReward{
+			TournamentID: tournamentID,
+			GroupRank:    details.GroupRank,
+			Amount:       details.Reward,
+			Items:        details.RewardItems,
+			Claimed:      details.RewardClaimed,
+		})
+	}
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].TournamentID > rewards[j].TournamentID })
+	return rewards
+}
+
+// Returns the coins and items the user earned in a completed tournament, either
+// fixed at finalization or calculated from their rank in their group.
+func (u *User) TournamentReward(db *dynamodb.DynamoDB, t Tournament) (Reward, error) {
+	details, ok := u.Tournaments[t.ID]
+	if !ok {
+		return Reward{}, errors.New("User is not in the tournament.")
+	}
+	if details.RewardFixed {
+		return Reward{Coins: details.Reward, Items: details.RewardItems}, nil
+	}
+	rank, err := u.GroupRank(db, t)
+	if err != nil || rank == 0 {
+		return Reward{}, err
+	}
+	return RankReward(rank - 1), nil
+}
+
+// Returns the one-based rank of the user in their group of the tournament, or
+// zero if the user is not in the group.
+func (u *User) GroupRank(db *dynamodb.DynamoDB, t Tournament) (int, error) {
+	details, ok := u.Tournaments[t.ID]
+	if !ok {
+		return 0, errors.New("User is not in the tournament.")
+	}
+	if details.RewardFixed {
+		return details.GroupRank, nil
+	}
+	group := Group{TournamentID: t.ID, GroupID: details.GroupID}
+	err := group.Fetch(db)
+	if err != nil {
+		return 0, err
+	}
+	for rank, p := range group.Ranking() {
+		if p.UserID == u.ID {
+			return rank + 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Returns the rewards the user has not claimed yet and can still claim at the
+// given time, latest tournament first.
+func (u *User) UnclaimedRewards(db *dynamodb.DynamoDB, now time.Time) ([]UserReward, error) {
+	rewards := []UserReward{}
+	for tournamentID, details := range u.Tournaments {
+		if details.RewardClaimed || details.Refunded || (details.RewardFixed && details.Reward == 0 && len(details.RewardItems) == 0) {
+			continue
+		}
+		t := Tournament{ID: tournamentID}
+		err := t.Fetch(db)
+		if err != nil {
+			return rewards, err
+		}
+		if !t.Completed || t.Cancelled {
+			continue
+		}
+		expiresAt, err := t.ClaimExpiresAt()
+		if err != nil || now.After(expiresAt) {
+			continue
+		}
+		reward, err := u.TournamentReward(db, t)
+		if err != nil {
+			return rewards, err
+		}
+		if reward.IsEmpty() {
+			continue
+		}
+		rewards = append(rewards, UserReward{
+			TournamentID: tournamentID,
+			GroupRank:    details.GroupRank,
+			Amount:       reward.Coins,
+			Items:        reward.Items,
+			ExpiresAt:    expiresAt.Format(time.RFC3339),
+		})
+	}
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].TournamentID > rewards[j].TournamentID })
+	return rewards, nil
+}
+
 func (u *User) Fetch(db *dynamodb.DynamoDB) error {
 	out, err := db.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String("user"),
@@ -55,6 +209,10 @@ func (u *User) Fetch(db *dynamodb.DynamoDB) error {
 		u.Tournaments = map[string]UserTournamentDetails{}
 	}
 
+	if u.Inventory == nil {
+		u.Inventory = map[string]int{}
+	}
+
 	return nil
 }
 
@@ -70,13 +228,21 @@ func (u *User) Put(db *dynamodb.DynamoDB) (*dynamodb.PutItemOutput, error) {
 	return out, err
 }
 
-func (u *User) CanEnterTournament(t Tournament) (bool, error) {
-	if t.Completed {
+func (u *User) CanEnterTournament(t Tournament, payment string) (bool, error) {
+	if t.Team {
+		return false, errors.New("Teams enter this tournament, not players.")
+	} else if t.Completed {
 		return false, errors.New("This tournament has already been completed.")
+	} else if t.Cancelled {
+		return false, errors.New("This tournament has been cancelled.")
 	} else if _, alreadyIn := u.Tournaments[t.ID]; alreadyIn {
 		return false, errors.New("User is already in the tournament.")
-	} else if u.Coins < config.TournamentCost {
+	} else if payment != PaymentCoins && payment != PaymentTicket {
+		return false, errors.New("Unknown payment method.")
+	} else if payment == PaymentCoins && u.Coins < config.TournamentCost {
 		return false, errors.New("Insufficient funds.")
+	} else if payment == PaymentTicket && u.Inventory[ItemTicket] < 1 {
+		return false, errors.New("Insufficient tickets.")
 	} else if u.Level < config.TournamentMinLevel {
 		return false, errors.New(fmt.Sprintf("User must be above level %d.", config.TournamentMinLevel))
 	} else if time.Now().UTC().Hour() >= config.TournamentEnterDeadline {
@@ -85,96 +251,424 @@ func (u *User) CanEnterTournament(t Tournament) (bool, error) {
 	return true, nil
 }
 
-func (u *User) LevelUp(db *dynamodb.DynamoDB, tournamentID string) (*dynamodb.UpdateItemOutput, error) {
-	// Update user level and coins
+// Moves the user to the next level, gives the coins earned by the result and
+// updates their score in the tournament if they are participating.
+func (u *User) LevelUp(db *dynamodb.DynamoDB, tournamentID string, result LevelResult) (*dynamodb.UpdateItemOutput, error) {
+	// Update user level and coins, unless the level has changed in the meantime
+	update := u.levelUpdate(result)
 	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
 		TableName: aws.String("user"),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {S: aws.String(u.ID)},
 		},
-		UpdateExpression: aws.String("SET gameLevel = :gameLevel, coins = :coins"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":gameLevel": {N: aws.String(strconv.Itoa(u.Level + config.ProgressLevelReward))},
-			":coins":     {N: aws.String(strconv.Itoa(u.Coins + config.ProgressCoinReward))},
-		},
+		UpdateExpression:          aws.String("SET " + update.Expr),
+		ConditionExpression:       aws.String(update.Condition),
+		ExpressionAttributeValues: update.Values,
 	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+			return out, ErrLevelMismatch
+		}
+		return out, err
+	}
+	u.levelUp(result)
 	// Update tournament score if the user is participating
-	err = u.UpdateTournamentScore(db, tournamentID)
+	err = u.UpdateTournamentScore(db, tournamentID, result)
 	return out, err
 }
 
-func (u *User) UpdateTournamentScore(db *dynamodb.DynamoDB, tournamentID string) error {
-	// Update tournament score if the user is participating
-	var err error
-	if details, ok := u.Tournaments[tournamentID]; ok {
-		group := Group{TournamentID: tournamentID, GroupID: details.GroupID}
-		err := group.Fetch(db)
+// Returns the update that moves the user to the next level with the coins earned
+// by the result, conditional on the user's level.
+func (u *User) levelUpdate(result LevelResult) livesUpdate {
+	return livesUpdate{
+		Expr:      "gameLevel = gameLevel + :levelReward, coins = coins + :coins, streak = if_not_exists(streak, :zero) + :one",
+		Condition: "gameLevel = :gameLevel",
+		Values: map[string]*dynamodb.AttributeValue{
+			":gameLevel":   {N: aws.String(strconv.Itoa(u.Level))},
+			":levelReward": {N: aws.String(strconv.Itoa(config.ProgressLevelReward))},
+			":coins":       {N: aws.String(strconv.Itoa(result.Coins()))},
+			":zero":        {N: aws.String("0")},
+			":one":         {N: aws.String("1")},
+		},
+	}
+}
+
+// Applies a stored level update to the user.
+func (u *User) levelUp(result LevelResult) {
+	u.Level += config.ProgressLevelReward
+	u.Coins += result.Coins()
+	u.Streak++
+}
+
+// Adds the points earned by the result, according to the tournament's scoring
+// policy, to the user's score if they are participating in the tournament and it
+// is active.
+func (u *User) UpdateTournamentScore(db *dynamodb.DynamoDB, tournamentID string, result LevelResult) error {
+	details, ok := u.Tournaments[tournamentID]
+	if !ok {
+		return nil
+	}
+	t := Tournament{ID: tournamentID}
+	err := t.Fetch(db)
+	if err != nil {
+		return err
+	}
+	// Scores only count between the start and the end of the tournament, and not
+	// after it has been finalized or cancelled
+	if !t.IsActive(time.Now().UTC()) {
+		return nil
+	}
+	policy, err := GetScoringPolicy(t.Scoring)
+	if err != nil {
+		return err
+	}
+	group := Group{TournamentID: tournamentID, GroupID: details.GroupID}
+	err = group.Fetch(db)
+	if err != nil {
+		return err
+	}
+	return group.UpdateScore(db, u, policy.Points(result, u.Streak))
+}
+
+// Gives the reward of a tournament to the user and records it in the ledger. The
+// update is conditional on the claim flag, so a reward cannot be claimed twice.
+func (u *User) ClaimReward(db *dynamodb.DynamoDB, reward Reward, tournamentID string) error {
+	var entries []LedgerEntry
+	if reward.Coins != 0 {
+		entries = append(entries, NewLedgerEntry(u.ID, LedgerReasonTournamentReward, reward.Coins, tournamentID))
+	}
+	entries = append(entries, NewItemLedgerEntries(u.ID, LedgerReasonTournamentReward, reward.Items, tournamentID)...)
+	ledger, err := ledgerPuts(entries...)
+	if err != nil {
+		return err
+	}
+	names := map[string]*string{
+		"#tid": aws.String(tournamentID),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":amount":     {N: aws.String(strconv.Itoa(reward.Coins))},
+		":claimed":    {BOOL: aws.Bool(true)},
+		":notClaimed": {BOOL: aws.Bool(false)},
+	}
+	expr := "SET coins = coins + :amount, tournaments.#tid.rewardClaimed = :claimed"
+	if len(reward.Items) > 0 {
+		err = u.ensureInventory(db)
 		if err != nil {
 			return err
 		}
-		err = group.UpdateScore(db, u)
+		expr += ", " + inventoryUpdate(reward.Items, names, values)
 	}
-	return err
-}
-
-func (u *User) ClaimReward(db *dynamodb.DynamoDB, amount int, tournamentID string) error {
+	out, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:          aws.String(expr),
+					ConditionExpression:       aws.String("tournaments.#tid.rewardClaimed = :notClaimed"),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return ErrRewardClaimed
+		}
+		return err
+	}
+	_ = out
 	details := u.Tournaments[tournamentID]
 	details.RewardClaimed = true
 	u.Tournaments[tournamentID] = details
-	av, _ := dynamodbattribute.MarshalMap(u.Tournaments)
-	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+	u.Coins += reward.Coins
+	for item, quantity := range reward.Items {
+		u.Inventory[item] += quantity
+	}
+	return nil
+}
+
+// Stores the final group rank and reward of a user in a tournament. A reward that
+// is already fixed is never changed, so recalculating a tournament keeps it.
+func setFixedReward(db *dynamodb.DynamoDB, userID string, tournamentID string, rank int, reward Reward) error {
+	items, _ := dynamodbattribute.MarshalMap(reward.Items)
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
 		TableName: aws.String("user"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"id": {S: aws.String(u.ID)},
+			"id": {S: aws.String(userID)},
+		},
+		UpdateExpression:    aws.String("SET tournaments.#tid.groupRank = :rank, tournaments.#tid.reward = :reward, tournaments.#tid.rewardItems = :items, tournaments.#tid.rewardFixed = :fixed"),
+		ConditionExpression: aws.String("attribute_exists(tournaments.#tid) AND (attribute_not_exists(tournaments.#tid.rewardFixed) OR tournaments.#tid.rewardFixed = :notFixed)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#tid": aws.String(tournamentID),
 		},
-		UpdateExpression: aws.String("SET coins = :coins, tournaments = :tournaments"),
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":tournaments": {M: av},
-			":coins":       {N: aws.String(strconv.Itoa(u.Coins + amount))},
+			":rank":     {N: aws.String(strconv.Itoa(rank))},
+			":reward":   {N: aws.String(strconv.Itoa(reward.Coins))},
+			":items":    {M: items},
+			":fixed":    {BOOL: aws.Bool(true)},
+			":notFixed": {BOOL: aws.Bool(false)},
 		},
 	})
-	_ = out
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return nil
+	}
 	return err
 }
 
-func (u *User) EnterTournament(db *dynamodb.DynamoDB, tournament Tournament) error {
+// Puts the user in a group of the tournament and takes the entry cost with the
+// given payment method.
+func (u *User) EnterTournament(db *dynamodb.DynamoDB, tournament Tournament, payment string) error {
 	// Update group
-	group, err := tournament.FetchLastGroup(db)
+	group, err := tournament.Seat(db, UserTournamentRecord{UserID: u.ID, Score: 0, Country: u.Country}, u.CurrentLeague(), config.GroupMaxLength)
+	if err != nil {
+		return err
+	}
+	err = u.payEntry(db, tournament, payment, group)
 	if err != nil {
-		panic(err)
+		// Free the seat of a user who has not entered
+		group.RemoveRecord(db, u.ID)
+		return err
 	}
-	// If there is no empty seat, create a new group and put the user in
-	if group.Players == nil || len(group.Players) > config.GroupMaxLength {
-		group = Group{
-			TournamentID: tournament.ID,
-			GroupID:      group.GroupID + 1,
-			Players:      []UserTournamentRecord{{UserID: u.ID, Score: 0, Country: u.Country}},
+	return nil
+}
+
+// Charges the entry cost and adds the tournament to the user with the group
+// they are seated in.
+func (u *User) payEntry(db *dynamodb.DynamoDB, tournament Tournament, payment string, group Group) error {
+	// Charge the entry cost and add the tournament to the user together with its
+	// ledger entry. The user is charged only once even if entries race.
+	err := u.ensureMap(db, "tournaments")
+	if err != nil {
+		return err
+	}
+	details := UserTournamentDetails{GroupID: group.GroupID, RewardClaimed: false, PaidWith: payment, League: group.League}
+	av, err := dynamodbattribute.MarshalMap(details)
+	if err != nil {
+		return errors.New("Cannot marshal the tournament details.")
+	}
+	entry := NewLedgerEntry(u.ID, LedgerReasonTournamentEntry, -config.TournamentCost, tournament.ID)
+	names := map[string]*string{
+		"#tid": aws.String(tournament.ID),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":details": {M: av},
+	}
+	expr := "SET tournaments.#tid = :details, "
+	condition := "attribute_not_exists(tournaments.#tid) AND "
+	if payment == PaymentTicket {
+		entry.Amount, entry.Item = -1, ItemTicket
+		names["#ticket"] = aws.String(ItemTicket)
+		values[":one"] = &dynamodb.AttributeValue{N: aws.String("1")}
+		expr += "inventory.#ticket = inventory.#ticket - :one"
+		condition += "inventory.#ticket >= :one"
+	} else {
+		values[":cost"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(config.TournamentCost))}
+		expr += "coins = coins - :cost"
+		condition += "coins >= :cost"
+	}
+	ledger, err := ledgerPuts(entry)
+	if err != nil {
+		return err
+	}
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append([]*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:          aws.String(expr),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+			{
+				// The tournament must still be open, so that a cancellation
+				// that has already refunded everyone does not miss this entry
+				ConditionCheck: &dynamodb.ConditionCheck{
+					TableName: aws.String("tournament"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(tournament.ID)},
+					},
+					ConditionExpression: aws.String("(attribute_not_exists(cancelled) OR cancelled = :false) AND (attribute_not_exists(completed) OR completed = :false)"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":false": {BOOL: aws.Bool(false)},
+					},
+				},
+			},
+		}, ledger...),
+	})
+	if err != nil {
+		failed := failedConditions(err)
+		if slices.Contains(failed, 1) {
+			return ErrTournamentClosed
 		}
-		out, err := group.Put(db)
-		if err != nil {
-			panic(err)
+		if len(failed) > 0 {
+			return ErrEntryRejected
 		}
-		_ = out
-	} else { // If there is an empty seat, put the user in that group
-		err = group.AddUser(db, u)
+		return err
+	}
+	if u.Tournaments == nil {
+		u.Tournaments = map[string]UserTournamentDetails{}
+	}
+	u.Tournaments[tournament.ID] = details
+	if payment == PaymentTicket {
+		u.Inventory[ItemTicket]--
+	} else {
+		u.Coins -= config.TournamentCost
+	}
+	return nil
+}
+
+// Gives the entry cost of a cancelled tournament back to the user, in coins or as
+// a ticket depending on how it was paid. The update is conditional on the refund
+// flag, so a user cannot be refunded twice.
+func (u *User) RefundTournament(db *dynamodb.DynamoDB, tournamentID string) error {
+	details, ok := u.Tournaments[tournamentID]
+	if !ok {
+		return errors.New("User is not in the tournament.")
+	}
+	if details.Refunded {
+		return nil
+	}
+	// Refund and its ledger entry are written in one transaction
+	entry := NewLedgerEntry(u.ID, LedgerReasonTournamentRefund, config.TournamentCost, tournamentID)
+	names := map[string]*string{
+		"#tid": aws.String(tournamentID),
+	}
+	values := map[string]*dynamodb.AttributeValue{
+		":refunded":    {BOOL: aws.Bool(true)},
+		":notRefunded": {BOOL: aws.Bool(false)},
+	}
+	expr := "SET tournaments.#tid.refunded = :refunded, "
+	if details.PaidWith == PaymentTicket {
+		err := u.ensureInventory(db)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		entry.Amount, entry.Item = 1, ItemTicket
+		expr += inventoryUpdate(map[string]int{ItemTicket: 1}, names, values)
+	} else {
+		values[":amount"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(entry.Amount))}
+		expr += "coins = coins + :amount"
 	}
-	// Update user model
-	u.Tournaments[tournament.ID] = UserTournamentDetails{GroupID: group.GroupID, RewardClaimed: false}
-	av, _ := dynamodbattribute.MarshalMap(u.Tournaments)
-	out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+	av, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return errors.New("Cannot marshal the ledger entry.")
+	}
+	out, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:          aws.String(expr),
+					ConditionExpression:       aws.String("attribute_not_exists(tournaments.#tid.refunded) OR tournaments.#tid.refunded = :notRefunded"),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName: aws.String("ledger"),
+					Item:      av,
+				},
+			},
+		},
+	})
+	if err != nil {
+		// Another run has already refunded this user
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			if err := u.Fetch(db); err == nil && u.Tournaments[tournamentID].Refunded {
+				return nil
+			}
+		}
+		return err
+	}
+	_ = out
+	details.Refunded = true
+	u.Tournaments[tournamentID] = details
+	if entry.Item != "" {
+		u.Inventory[entry.Item] += entry.Amount
+	} else {
+		u.Coins += entry.Amount
+	}
+	return nil
+}
+
+// Changes the role of the user. It takes effect when the user logs in or
+// refreshes their tokens.
+func (u *User) SetRole(db *dynamodb.DynamoDB, role string) error {
+	if !slices.Contains(Roles, role) {
+		return fmt.Errorf("Unknown role: %s", role)
+	}
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
 		TableName: aws.String("user"),
 		Key: map[string]*dynamodb.AttributeValue{
 			"id": {S: aws.String(u.ID)},
 		},
-		UpdateExpression: aws.String("SET tournaments = :tournaments, coins = :coins"),
+		UpdateExpression:    aws.String("SET #role = :role"),
+		ConditionExpression: aws.String("attribute_exists(id)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#role": aws.String("role"),
+		},
 		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":tournaments": {M: av},
-			":coins":       {N: aws.String(strconv.Itoa(u.Coins - config.TournamentCost))},
+			":role": {S: aws.String(role)},
 		},
 	})
+	if err != nil {
+		return err
+	}
+	u.Role = role
+	return nil
+}
+
+// Adds the amount of the ledger entry to the user's coins and records the entry
+// in the same transaction. A negative amount fails if the user cannot afford it.
+func (u *User) AddCoins(db *dynamodb.DynamoDB, entry LedgerEntry) error {
+	av, err := dynamodbattribute.MarshalMap(entry)
+	if err != nil {
+		return errors.New("Cannot marshal the ledger entry.")
+	}
+	out, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("user"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"id": {S: aws.String(u.ID)},
+					},
+					UpdateExpression:    aws.String("SET coins = coins + :amount"),
+					ConditionExpression: aws.String("attribute_exists(id) AND coins >= :minCoins"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":amount":   {N: aws.String(strconv.Itoa(entry.Amount))},
+						":minCoins": {N: aws.String(strconv.Itoa(max(0, -entry.Amount)))},
+					},
+				},
+			},
+			{
+				Put: &dynamodb.Put{
+					TableName: aws.String("ledger"),
+					Item:      av,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException {
+			return errors.New("Insufficient funds.")
+		}
+		return err
+	}
 	_ = out
-	return err
+	u.Coins += entry.Amount
+	return nil
 }
@@ -0,0 +1,164 @@
+package structs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	ErrUsernameTaken      = errors.New("Username is already taken.")
+	ErrUsernameCharacters = errors.New("Username can only contain letters, digits, spaces and _-.#")
+	ErrUsernameBlocked    = errors.New("Username is not allowed.")
+	ErrRenameCooldown     = errors.New("Username was changed recently.")
+)
+
+// Symbols allowed in usernames besides letters and digits.
+const usernameSymbols = " _-.#"
+
+// Letters that are commonly replaced by digits to get around the blocklist.
+var blocklistReplacer = strings.NewReplacer("0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t")
+
+// Reserves a username for a user, so that each username is used only once.
+// Usernames are unique regardless of case.
+type UsernameReservation struct {
+	Name      string `json:"name"` // lowercase username
+	UserID    string `json:"userID"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// Returns the reservation key of a username.
+func usernameKey(name string) string {
+	return strings.ToLower(name)
+}
+
+// Validates a username and returns it in normalized form. Lengths are counted
+// in characters, not bytes.
+func NormalizeUsername(name string) (string, error) {
+	name = norm.NFC.String(strings.TrimSpace(name))
+	length := utf8.RuneCountInString(name)
+	if length < config.UsernameMinLength || length > config.UsernameMaxLength {
+		return name, fmt.Errorf("Username must contain %d to %d characters.", config.UsernameMinLength, config.UsernameMaxLength)
+	}
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !strings.ContainsRune(usernameSymbols, r) {
+			return name, ErrUsernameCharacters
+		}
+	}
+	if strings.Contains(name, "  ") {
+		return name, ErrUsernameCharacters
+	}
+	if usernameBlocked(name) {
+		return name, ErrUsernameBlocked
+	}
+	return name, nil
+}
+
+func usernameBlocked(name string) bool {
+	letters := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(usernameSymbols, r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, name)
+	letters = blocklistReplacer.Replace(letters)
+	for _, word := range config.UsernameBlocklist {
+		if strings.Contains(letters, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func reservationPut(name string, userID string) (*dynamodb.Put, error) {
+	av, err := dynamodbattribute.MarshalMap(UsernameReservation{
+		Name:      usernameKey(name),
+		UserID:    userID,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return nil, errors.New("Cannot marshal the username.")
+	}
+	return &dynamodb.Put{
+		TableName:           aws.String("username"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(#name)"),
+		ExpressionAttributeNames: map[string]*string{
+			"#name": aws.String("name"),
+		},
+	}, nil
+}
+
+// Returns the indexes of the items whose condition failed in a cancelled
+// transaction.
+func failedConditions(err error) []int {
+	var indexes []int
+	if cerr, ok := err.(*dynamodb.TransactionCanceledException); ok {
+		for i, reason := range cerr.CancellationReasons {
+			if aws.StringValue(reason.Code) == "ConditionalCheckFailed" {
+				indexes = append(indexes, i)
+			}
+		}
+	}
+	return indexes
+}
+
+// Stores a new user together with its username reservation and identities.
+// Returns ErrUsernameTaken or ErrIdentityTaken if either is used by another user.
+func (u *User) Create(db *dynamodb.DynamoDB, identities ...Identity) error {
+	user, err := dynamodbattribute.MarshalMap(u)
+	if err != nil {
+		return errors.New("Cannot marshal the user.")
+	}
+	reservation, err := reservationPut(u.Username, u.ID)
+	if err != nil {
+		return err
+	}
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String("user"),
+				Item:                user,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		},
+		{Put: reservation},
+	}
+	for _, identity := range identities {
+		identity.UserID = u.ID
+		av, err := dynamodbattribute.MarshalMap(identity)
+		if err != nil {
+			return errors.New("Cannot marshal the identity.")
+		}
+		items = append(items, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				TableName:           aws.String("identity"),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(id)"),
+			},
+		})
+	}
+
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		for _, i := range failedConditions(err) {
+			if i == 1 {
+				return ErrUsernameTaken
+			} else if i > 1 {
+				return ErrIdentityTaken
+			}
+		}
+		return err
+	}
+	return nil
+}
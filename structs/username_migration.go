@@ -0,0 +1,81 @@
+package structs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Result of MigrateUsernames.
+type UsernameMigration struct {
+	Reserved   int      `json:"reserved"`   // usernames reserved for their users
+	Collisions []string `json:"collisions"` // IDs of users whose username is reserved by another user, left as is
+}
+
+// Reserves the usernames of users stored before usernames were unique. When two
+// users share a username regardless of case, the first one reserved keeps it and
+// the others are reported as collisions to be renamed. Usernames that are already
+// reserved for their users are skipped, so the migration can safely be run again.
+func MigrateUsernames(db *dynamodb.DynamoDB) (UsernameMigration, error) {
+	migration := UsernameMigration{Collisions: []string{}}
+
+	var users []User
+	err := db.ScanPages(&dynamodb.ScanInput{TableName: aws.String("user")}, func(out *dynamodb.ScanOutput, last bool) bool {
+		for _, e := range out.Items {
+			var user User
+			dynamodbattribute.UnmarshalMap(e, &user)
+			users = append(users, user)
+		}
+		return true
+	})
+	if err != nil {
+		return migration, err
+	}
+	for _, user := range users {
+		if user.Username == "" {
+			continue
+		}
+		put, err := reservationPut(user.Username, user.ID)
+		if err != nil {
+			return migration, err
+		}
+		_, err = db.PutItem(&dynamodb.PutItemInput{
+			TableName:                put.TableName,
+			Item:                     put.Item,
+			ConditionExpression:      put.ConditionExpression,
+			ExpressionAttributeNames: put.ExpressionAttributeNames,
+		})
+		if err == nil {
+			migration.Reserved++
+			continue
+		}
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException {
+			return migration, err
+		}
+		reservation, err := fetchReservation(db, user.Username)
+		if err != nil {
+			return migration, err
+		}
+		if reservation.UserID != user.ID {
+			migration.Collisions = append(migration.Collisions, user.ID)
+		}
+	}
+	return migration, nil
+}
+
+// Returns the reservation of a username.
+func fetchReservation(db *dynamodb.DynamoDB, name string) (UsernameReservation, error) {
+	var reservation UsernameReservation
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("username"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"name": {S: aws.String(usernameKey(name))},
+		},
+	})
+	if err != nil {
+		return reservation, err
+	}
+	err = dynamodbattribute.UnmarshalMap(out.Item, &reservation)
+	return reservation, err
+}
@@ -0,0 +1,43 @@
+package structs
+
+import (
+	"strings"
+	"testing"
+
+	"oguzhanakan0/good-blast-api/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeUsername(t *testing.T) {
+	name, err := NormalizeUsername("  Blaster#42 ")
+	assert.Nil(t, err)
+	assert.Equal(t, "Blaster#42", name)
+
+	// Lengths are counted in characters
+	_, err = NormalizeUsername("Öz")
+	assert.NotNil(t, err)
+	name, err = NormalizeUsername("Şükrü")
+	assert.Nil(t, err)
+	assert.Equal(t, "Şükrü", name)
+	_, err = NormalizeUsername(strings.Repeat("ü", config.UsernameMaxLength))
+	assert.Nil(t, err)
+	_, err = NormalizeUsername(strings.Repeat("ü", config.UsernameMaxLength+1))
+	assert.NotNil(t, err)
+
+	// Combining marks are composed, so the same name is stored the same way
+	name, err = NormalizeUsername("Su\u0308kru\u0308")
+	assert.Nil(t, err)
+	assert.Equal(t, "S\u00fckr\u00fc", name)
+
+	_, err = NormalizeUsername("Blast<script>")
+	assert.Equal(t, ErrUsernameCharacters, err)
+	_, err = NormalizeUsername("Good  Blast")
+	assert.Equal(t, ErrUsernameCharacters, err)
+
+	// Blocked words are found regardless of case, symbols and substitutions
+	_, err = NormalizeUsername("The.Adm1n")
+	assert.Equal(t, ErrUsernameBlocked, err)
+	_, err = NormalizeUsername("SH_1T")
+	assert.Equal(t, ErrUsernameBlocked, err)
+}
@@ -0,0 +1,137 @@
+package structs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"oguzhanakan0/good-blast-api/config"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var (
+	ErrInvalidCode         = errors.New("Code is not valid or has expired.")
+	ErrCodeCooldown        = errors.New("A code was sent recently, try again later.")
+	ErrIdentityNotVerified = errors.New("Identity is not verified.")
+)
+
+// A one-time code sent to the owner of an identity, e.g. by email. Using the
+// code proves that the caller owns the identity. Only the hash of the code is
+// stored, and each identity has at most one code at a time.
+type Verification struct {
+	IdentityID string `json:"identityID"`
+	UserID     string `json:"userID"` // user the identity was linked to when the code was sent
+	CodeHash   string `json:"codeHash"`
+	SentAt     int64  `json:"sentAt"`    // unix seconds
+	ExpiresAt  int64  `json:"expiresAt"` // unix seconds
+	Attempts   int    `json:"attempts"`  // wrong codes tried
+}
+
+// Returns the hash a code of the identity is stored with.
+func hashCode(identityID string, code string) string {
+	sum := sha256.Sum256([]byte(identityID + "#" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns a random code of config.VerifyCodeLength digits.
+func newCode() (string, error) {
+	limit := new(big.Int).Exp(big.NewInt(10), big.NewInt(config.VerifyCodeLength), nil)
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%0*d", config.VerifyCodeLength, n), nil
+}
+
+// Creates a new code for the identity, replacing the previous one, and returns
+// it so that it can be sent. A new code can be requested once every
+// config.VerifyCodeResendSeconds seconds.
+func (i *Identity) NewCode(db *dynamodb.DynamoDB, now time.Time) (string, error) {
+	code, err := newCode()
+	if err != nil {
+		return "", err
+	}
+	av, err := dynamodbattribute.MarshalMap(Verification{
+		IdentityID: i.ID,
+		UserID:     i.UserID,
+		CodeHash:   hashCode(i.ID, code),
+		SentAt:     now.Unix(),
+		ExpiresAt:  now.Add(config.VerifyCodeMinutes * time.Minute).Unix(),
+	})
+	if err != nil {
+		return "", errors.New("Cannot marshal the verification.")
+	}
+	_, err = db.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("verification"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(identityID) OR sentAt <= :resendAfter"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":resendAfter": {N: aws.String(strconv.FormatInt(now.Unix()-config.VerifyCodeResendSeconds, 10))},
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return "", ErrCodeCooldown
+	}
+	return code, err
+}
+
+// Checks the code sent to the identity and uses it up. Returns ErrInvalidCode
+// if the code is wrong or expired, if too many wrong codes were tried, or if the
+// identity has been linked to another user since the code was sent.
+func (i *Identity) UseCode(db *dynamodb.DynamoDB, code string, now time.Time) error {
+	key := map[string]*dynamodb.AttributeValue{
+		"identityID": {S: aws.String(i.ID)},
+	}
+	out, err := db.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("verification"),
+		Key:       key,
+	})
+	if err != nil {
+		return err
+	}
+	var v Verification
+	if out.Item == nil || dynamodbattribute.UnmarshalMap(out.Item, &v) != nil {
+		return ErrInvalidCode
+	}
+	if v.UserID != i.UserID || now.Unix() >= v.ExpiresAt || v.Attempts >= config.VerifyCodeMaxAttempts {
+		return ErrInvalidCode
+	}
+	maxAttempts := &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(config.VerifyCodeMaxAttempts))}
+	if hashCode(i.ID, code) != v.CodeHash {
+		_, err = db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:           aws.String("verification"),
+			Key:                 key,
+			UpdateExpression:    aws.String("ADD attempts :one"),
+			ConditionExpression: aws.String("attribute_exists(identityID)"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":one": {N: aws.String("1")},
+			},
+		})
+		if aerr, ok := err.(awserr.Error); err != nil && (!ok || aerr.Code() != dynamodb.ErrCodeConditionalCheckFailedException) {
+			return err
+		}
+		return ErrInvalidCode
+	}
+	// Delete the code, so that it is used only once even if requests race
+	_, err = db.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String("verification"),
+		Key:                 key,
+		ConditionExpression: aws.String("codeHash = :hash AND attempts < :max"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":hash": {S: aws.String(v.CodeHash)},
+			":max":  maxAttempts,
+		},
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrInvalidCode
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+package structs
+
+import (
+	"oguzhanakan0/good-blast-api/config"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCode(t *testing.T) {
+	code, err := newCode()
+	assert.Nil(t, err)
+	assert.Len(t, code, config.VerifyCodeLength)
+	_, err = strconv.Atoi(code)
+	assert.Nil(t, err)
+}
+
+func TestHashCode(t *testing.T) {
+	assert.Equal(t, hashCode("email#a@b.c", "123456"), hashCode("email#a@b.c", "123456"))
+	assert.NotEqual(t, hashCode("email#a@b.c", "123456"), hashCode("email#a@b.c", "123457"))
+	// The same code of another identity has another hash
+	assert.NotEqual(t, hashCode("email#a@b.c", "123456"), hashCode("email#d@e.f", "123456"))
+}